@@ -2,26 +2,41 @@ package main
 
 import (
 	"event-history/pkg/app"
-	"event-history/pkg/repository"
 	"fmt"
 	"log"
 )
 
 const (
-	httpServeCommand = "http-serve"
-	migrateCommand   = "migrate"
-	rollbackCommand  = "rollback"
+	httpServeCommand       = "http-serve"
+	migrateCommand         = "migrate"
+	rollbackCommand        = "rollback"
+	rebuildSnapshotCommand = "rebuild-snapshot"
+	verifyCommand          = "verify"
+	compactHistoryCommand  = "compact-history"
+	archiveHistoryCommand  = "archive-history"
+	partitionsCommand      = "partitions"
 )
 
-func commands() map[string]func(configFile string) {
-	return map[string]func(configFile string){
-		httpServeCommand: app.StartHTTPServer,
-		migrateCommand:   repository.RunMigrations,
-		rollbackCommand:  repository.RollBackMigrations,
+func commands() map[string]func(configFile string, args []string) {
+	return map[string]func(configFile string, args []string){
+		httpServeCommand:       withoutArgs(app.StartHTTPServer),
+		migrateCommand:         app.Migrate,
+		rollbackCommand:        withoutArgs(app.RollBack),
+		rebuildSnapshotCommand: app.RebuildSnapshot,
+		verifyCommand:          app.VerifySnapshot,
+		compactHistoryCommand:  app.CompactHistory,
+		archiveHistoryCommand:  app.ArchiveHistory,
+		partitionsCommand:      app.ManagePartitions,
 	}
 }
 
-func execute(cmd string, configFile string) {
+func withoutArgs(run func(configFile string)) func(configFile string, args []string) {
+	return func(configFile string, _ []string) {
+		run(configFile)
+	}
+}
+
+func execute(cmd string, args []string, configFile string) {
 	fmt.Println("cmd : " + cmd)
 	fmt.Println("config : " + configFile)
 	run, ok := commands()[cmd]
@@ -29,5 +44,5 @@ func execute(cmd string, configFile string) {
 		log.Fatal("invalid command")
 	}
 
-	run(configFile)
+	run(configFile, args)
 }
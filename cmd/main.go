@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"log"
 )
 
 const (
@@ -15,5 +16,9 @@ func main() {
 	flag.StringVar(&configFile, configFileKey, defaultConfigFile, configFileUsage)
 	flag.Parse()
 
-	execute(flag.Args()[0], configFile)
+	if flag.NArg() < 1 {
+		log.Fatal("command is missing")
+	}
+
+	execute(flag.Arg(0), flag.Args()[1:], configFile)
 }
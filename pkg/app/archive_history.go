@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"event-history/pkg/archive"
+	"event-history/pkg/config"
+	"event-history/pkg/repository"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ArchiveHistory moves the event_history records older than a cutoff into
+// the archive directory and logs a summary. With -verify it instead checks
+// the archived segments against the checksums of the manifest and exits with
+// status 1 if any does not match.
+//
+//	archive-history (-before <date> | -older-than-days <n>) [-dir <dir>] [-user <user_id>] [-batch-size <n>] [-dry-run]
+//	archive-history -verify [-dir <dir>]
+func ArchiveHistory(configFile string, args []string) {
+	flags := flag.NewFlagSet("archive-history", flag.ExitOnError)
+	before := flags.String("before", "", "archive records created before this date (YYYY-MM-DD) or RFC3339 timestamp")
+	olderThanDays := flags.Int("older-than-days", 0, "archive records older than this many days")
+	dir := flags.String("dir", "", "archive directory, ARCHIVE_DIR by default")
+	userId := flags.String("user", "", "only archive the history of this user")
+	batchSize := flags.Int("batch-size", 1000, "number of records archived per transaction")
+	dryRun := flags.Bool("dry-run", false, "report what would be archived without changing event_history")
+	verify := flags.Bool("verify", false, "check the archived segments against their checksums")
+	_ = flags.Parse(args)
+
+	cfg := config.NewConfig(configFile)
+	logger := initLogger(cfg)
+	defer func() { _ = logger.Sync() }()
+
+	if *dir == "" {
+		*dir = cfg.GetArchiveConfig().GetDir()
+	}
+	if *dir == "" {
+		log.Fatal("an archive directory is needed, set ARCHIVE_DIR or -dir")
+	}
+	store := archive.NewFileStore(*dir)
+
+	if *verify {
+		verifyArchive(logger, store)
+		return
+	}
+
+	cutoff, err := archiveCutoff(*before, *olderThanDays)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	archiver := repository.NewHistoryArchiver(initDB(cfg), store)
+	opts := repository.ArchiveOptions{Before: cutoff, UserId: *userId, BatchSize: *batchSize, DryRun: *dryRun}
+
+	result, err := archiver.Archive(context.Background(), opts)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	logger.Info("history archived",
+		zap.Bool("dryRun", result.DryRun),
+		zap.Time("before", cutoff),
+		zap.Int64("records", result.Records),
+		zap.Int("segments", result.Segments),
+		zap.Int64("prunedBlobs", result.PrunedBlobs),
+	)
+}
+
+func verifyArchive(logger *zap.Logger, store archive.Store) {
+	broken, err := store.Verify()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	for _, segment := range broken {
+		logger.Error("archive segment does not match its checksum", zap.String("path", segment.Path))
+	}
+	logger.Info("archive verified", zap.Int("brokenSegments", len(broken)))
+
+	if len(broken) > 0 {
+		_ = logger.Sync()
+		os.Exit(1)
+	}
+}
+
+// archiveCutoff takes exactly one of a date or timestamp and a number of days.
+func archiveCutoff(before string, olderThanDays int) (time.Time, error) {
+	if (before == "") == (olderThanDays <= 0) {
+		return time.Time{}, errors.New("exactly one of -before and -older-than-days is needed")
+	}
+	if olderThanDays > 0 {
+		return time.Now().AddDate(0, 0, -olderThanDays), nil
+	}
+
+	if cutoff, err := time.Parse("2006-01-02", before); err == nil {
+		return cutoff, nil
+	}
+	return time.Parse(time.RFC3339, before)
+}
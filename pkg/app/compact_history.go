@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"event-history/pkg/config"
+	"event-history/pkg/repository"
+	"flag"
+	"log"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CompactHistory prunes event_history according to the retention policies of
+// the config and logs a summary of what was pruned.
+//
+//	compact-history [-user <user_id>] [-batch-size <n>] [-dry-run]
+func CompactHistory(configFile string, args []string) {
+	flags := flag.NewFlagSet("compact-history", flag.ExitOnError)
+	userId := flags.String("user", "", "only compact the history of this user")
+	batchSize := flags.Int("batch-size", 500, "number of keys compacted per transaction")
+	dryRun := flags.Bool("dry-run", false, "report what would be pruned without changing event_history")
+	_ = flags.Parse(args)
+
+	cfg := config.NewConfig(configFile)
+	logger := initLogger(cfg)
+	defer func() { _ = logger.Sync() }()
+
+	compactor := repository.NewHistoryCompactor(initDB(cfg))
+	opts := compactOptions(cfg.GetRetentionConfig())
+	opts.UserId, opts.BatchSize, opts.DryRun = *userId, *batchSize, *dryRun
+
+	result, err := compactor.Compact(context.Background(), opts)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	logCompactResult(logger, result)
+}
+
+// startScheduledCompaction compacts history in the background of the HTTP
+// server when a compaction interval is configured.
+func startScheduledCompaction(ctx context.Context, cfg config.Config, logger *zap.Logger) {
+	interval := cfg.GetRetentionConfig().GetCompactInterval()
+	if interval <= 0 {
+		return
+	}
+
+	if dbConfig := cfg.GetDBConfig(); dbConfig.Driver() == config.MemoryDriver {
+		logger.Warn("scheduled history compaction is not supported by the memory driver")
+		return
+	}
+
+	compactor := repository.NewHistoryCompactor(initDB(cfg))
+	go runCompaction(ctx, compactor, compactOptions(cfg.GetRetentionConfig()), interval, logger)
+}
+
+func runCompaction(ctx context.Context, compactor repository.HistoryCompactor, opts repository.CompactOptions, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := compactor.Compact(ctx, opts)
+			if err != nil {
+				logger.Error("failed to compact history", zap.Error(err))
+				continue
+			}
+			logCompactResult(logger, result)
+		}
+	}
+}
+
+func compactOptions(rc config.RetentionConfig) repository.CompactOptions {
+	opts := repository.CompactOptions{Default: retentionPolicy(rc.GetDefaultPolicy())}
+	for _, override := range rc.GetOverrides() {
+		opts.Overrides = append(opts.Overrides, retentionPolicy(override))
+	}
+	return opts
+}
+
+func retentionPolicy(policy config.RetentionPolicy) repository.RetentionPolicy {
+	return repository.RetentionPolicy{
+		KeyPrefix:    policy.KeyPrefix,
+		KeepVersions: policy.KeepVersions,
+		KeepFor:      time.Duration(policy.KeepDays) * 24 * time.Hour,
+	}
+}
+
+func logCompactResult(logger *zap.Logger, result *repository.CompactResult) {
+	logger.Info("history compacted",
+		zap.Bool("dryRun", result.DryRun),
+		zap.Int("keys", result.Keys),
+		zap.Int("compactedKeys", result.CompactedKeys),
+		zap.Int64("prunedRecords", result.PrunedRecords),
+		zap.Int64("prunedBlobs", result.PrunedBlobs),
+		zap.Any("prunedByPolicy", result.PrunedByPolicy),
+	)
+}
@@ -1,13 +1,19 @@
 package app
 
 import (
+	"context"
+	"database/sql"
+	"event-history/pkg/archive"
 	"event-history/pkg/config"
 	"event-history/pkg/eventinfo"
 	"event-history/pkg/http/router"
 	"event-history/pkg/http/server"
 	"event-history/pkg/reporters"
 	"event-history/pkg/repository"
+	"expvar"
+	"fmt"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 	"io"
 	"log"
 	"net/http"
@@ -17,13 +23,22 @@ import (
 func initHTTPServer(configFile string) {
 	config := config.NewConfig(configFile)
 	logger := initLogger(config)
-	rt := initRouter(config, logger)
 
-	server.NewServer(config, logger, rt).Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventRepo := initRepository(ctx, config, logger)
+	rt := initRouter(eventRepo, logger)
+	if reaperConfig := config.GetReaperConfig(); reaperConfig.GetInterval() > 0 {
+		reaper := eventinfo.NewReaper(eventRepo, logger, reaperConfig.GetInterval(), reaperConfig.GetBatchSize())
+		go reaper.Run(ctx)
+	}
+	startScheduledCompaction(ctx, config, logger)
+
+	server.NewServer(config, logger, rt, router.NewAdminRouter()).Start()
 }
 
-func initRouter(cfg config.Config, logger *zap.Logger) http.Handler {
-	eventRepo := initRepository(cfg)
+func initRouter(eventRepo repository.EventRepository, logger *zap.Logger) http.Handler {
 	eventService := initService(eventRepo)
 
 	return router.NewRouter(logger, eventService)
@@ -35,8 +50,92 @@ func initService(eventRepository repository.EventRepository) eventinfo.Service {
 	return eventService
 }
 
-func initRepository(cfg config.Config) repository.EventRepository {
+func initRepository(ctx context.Context, cfg config.Config, logger *zap.Logger) repository.EventRepository {
+	var eventRepo repository.EventRepository
+	if dbConfig := cfg.GetDBConfig(); dbConfig.Driver() == config.MemoryDriver {
+		eventRepo = repository.NewMemoryEventRepository()
+	} else {
+		db := initDB(cfg)
+		replicas := initReplicas(cfg)
+		publishPoolStats(db, replicas)
+
+		blobs := repository.NewBlobStore(cfg.GetBlobStoreConfig().GetThresholdInBytes())
+		reads := initReadRouter(ctx, cfg, db, replicas, logger)
+		timeouts := queryTimeouts(dbConfig)
+		eventRepo = repository.NewEventRepositoryWithTimeouts(db, blobs, reads, timeouts)
+		eventRepo = repository.NewRetryingEventRepository(eventRepo, retryPolicy(dbConfig), timeouts)
+	}
+
+	if dir := cfg.GetArchiveConfig().GetDir(); dir != "" {
+		return repository.NewArchivedEventRepository(eventRepo, archive.NewFileStore(dir))
+	}
+	return eventRepo
+}
+
+func initReplicas(cfg config.Config) []*gorm.DB {
+	replicas, err := repository.NewDBHandler(cfg.GetDBConfig()).GetReplicas()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return replicas
+}
+
+// initReadRouter sends reads to the replicas, or to db when there are none.
+func initReadRouter(ctx context.Context, cfg config.Config, db *gorm.DB, replicas []*gorm.DB, logger *zap.Logger) repository.ReadRouter {
+	if len(replicas) == 0 {
+		return repository.NewPrimaryRouter(db)
+	}
+
+	dbConfig := cfg.GetDBConfig()
+	router := repository.NewReplicaRouter(db, replicas, dbConfig.ReadAfterWriteWindow())
+	router.CheckHealth(ctx)
+	logger.Info("reading from replicas", zap.Int("replicas", len(replicas)), zap.Int("healthy", router.Healthy()))
+	go router.Run(ctx, dbConfig.ReplicaHealthCheckInterval())
+	return router
+}
+
+func queryTimeouts(dbConfig config.DBConfig) repository.QueryTimeouts {
+	return repository.QueryTimeouts{
+		Read:  dbConfig.ReadTimeout(),
+		Write: dbConfig.WriteTimeout(),
+		Batch: dbConfig.BatchTimeout(),
+	}
+}
+
+func retryPolicy(dbConfig config.DBConfig) repository.RetryPolicy {
+	return repository.RetryPolicy{
+		MaxAttempts: dbConfig.RetryMaxAttempts(),
+		BaseDelay:   dbConfig.RetryBaseDelay(),
+		MaxDelay:    dbConfig.RetryMaxDelay(),
+	}
+}
+
+// publishPoolStats exposes the connection pool stats of the primary and the
+// replicas as db_pools at /debug/vars.
+func publishPoolStats(db *gorm.DB, replicas []*gorm.DB) {
+	pools := map[string]*gorm.DB{"primary": db}
+	for i, replica := range replicas {
+		pools[fmt.Sprintf("replica_%d", i)] = replica
+	}
+
+	expvar.Publish("db_pools", expvar.Func(func() interface{} {
+		stats := map[string]sql.DBStats{}
+		for name, pool := range pools {
+			if sqlDB, err := pool.DB(); err == nil {
+				stats[name] = sqlDB.Stats()
+			}
+		}
+		return stats
+	}))
+}
+
+func initDB(cfg config.Config) *gorm.DB {
 	dbConfig := cfg.GetDBConfig()
+	if dbConfig.Driver() == config.MemoryDriver {
+		log.Fatal("this command needs a database, it is not supported by the memory driver")
+	}
+
 	dbHandler := repository.NewDBHandler(dbConfig)
 
 	db, err := dbHandler.GetDB()
@@ -44,7 +143,7 @@ func initRepository(cfg config.Config) repository.EventRepository {
 		log.Fatal(err.Error())
 	}
 
-	return repository.NewEventRepository(db)
+	return db
 }
 
 func initLogger(cfg config.Config) *zap.Logger {
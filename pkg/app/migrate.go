@@ -0,0 +1,96 @@
+package app
+
+import (
+	"encoding/json"
+	"event-history/pkg/config"
+	"event-history/pkg/repository"
+	"log"
+	"os"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// Migrate applies the pending migrations of the configured driver, which are
+// embedded in the binary. The status subcommand prints the migration status as
+// JSON and exits with status 1 if the database is dirty, goto migrates up or
+// down to a version, 0 reverting every migration, and force sets the version
+// of a dirty database once it was fixed by hand. Every failure exits with status 1.
+//
+//	migrate
+//	migrate status
+//	migrate goto <version>
+//	migrate force <version>
+func Migrate(configFile string, args []string) {
+	cfg := config.NewConfig(configFile)
+	dbConfig := cfg.GetDBConfig()
+	logger := initLogger(cfg)
+	defer func() { _ = logger.Sync() }()
+
+	if len(args) == 0 {
+		if err := repository.RunMigrations(dbConfig); err != nil {
+			log.Fatal(err.Error())
+		}
+		logger.Info("migrations applied")
+		return
+	}
+
+	switch args[0] {
+	case "status":
+		migrationStatus(logger, dbConfig)
+	case "goto":
+		version, err := strconv.ParseUint(versionArg(args), 10, 64)
+		if err != nil {
+			log.Fatalf("invalid version: %s", err)
+		}
+		if err := repository.MigrateTo(dbConfig, uint(version)); err != nil {
+			log.Fatal(err.Error())
+		}
+		logger.Info("migrated", zap.Uint64("version", version))
+	case "force":
+		version, err := strconv.Atoi(versionArg(args))
+		if err != nil {
+			log.Fatalf("invalid version: %s", err)
+		}
+		if err := repository.ForceMigration(dbConfig, version); err != nil {
+			log.Fatal(err.Error())
+		}
+		logger.Info("migration version forced", zap.Int("version", version))
+	default:
+		log.Fatalf("invalid migrate subcommand %q, expected status, goto or force", args[0])
+	}
+}
+
+// RollBack reverts the last applied migration, exiting with status 1 if it fails.
+func RollBack(configFile string) {
+	cfg := config.NewConfig(configFile)
+	if err := repository.RollBackMigrations(cfg.GetDBConfig()); err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+func migrationStatus(logger *zap.Logger, dbConfig config.DBConfig) {
+	status, err := repository.GetMigrationStatus(dbConfig)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(status); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if status.Dirty {
+		logger.Error("database is dirty, fix the failed migration and force its version", zap.Uint("version", status.Version))
+		_ = logger.Sync()
+		os.Exit(1)
+	}
+}
+
+func versionArg(args []string) string {
+	if len(args) != 2 {
+		log.Fatalf("%s needs exactly one version", args[0])
+	}
+	return args[1]
+}
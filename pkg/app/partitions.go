@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"event-history/pkg/config"
+	"event-history/pkg/repository"
+	"flag"
+	"log"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// ManagePartitions keeps the monthly partitions of event_history on postgres
+// ready ahead of time and detaches or drops the expired ones. With -list it
+// only prints the partitions as JSON.
+//
+//	partitions [-ahead <months>] [-retain-months <months>] [-detach-only] [-dry-run]
+//	partitions -list
+func ManagePartitions(configFile string, args []string) {
+	cfg := config.NewConfig(configFile)
+	partitionConfig := cfg.GetPartitionConfig()
+
+	flags := flag.NewFlagSet("partitions", flag.ExitOnError)
+	ahead := flags.Int("ahead", partitionConfig.GetAheadMonths(), "months of partitions created ahead of the current one")
+	retainMonths := flags.Int("retain-months", partitionConfig.GetRetainMonths(), "months of past partitions kept, 0 keeps all")
+	detachOnly := flags.Bool("detach-only", false, "detach expired partitions without dropping them")
+	dryRun := flags.Bool("dry-run", false, "report what would change without changing any partition")
+	list := flags.Bool("list", false, "print the partitions of event_history")
+	_ = flags.Parse(args)
+
+	logger := initLogger(cfg)
+	defer func() { _ = logger.Sync() }()
+
+	manager := repository.NewPartitionManager(initDB(cfg))
+	if *list {
+		partitions, err := manager.Partitions(context.Background())
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(partitions); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+
+	opts := repository.PartitionOptions{Ahead: *ahead, RetainMonths: *retainMonths, DetachOnly: *detachOnly, DryRun: *dryRun}
+	result, err := manager.Maintain(context.Background(), opts)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	logger.Info("partitions maintained",
+		zap.Bool("dryRun", result.DryRun),
+		zap.Strings("created", result.Created),
+		zap.Strings("detached", result.Detached),
+		zap.Strings("dropped", result.Dropped),
+		zap.Int64("kept", result.Kept),
+	)
+}
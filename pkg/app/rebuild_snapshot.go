@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"event-history/pkg/config"
+	"event-history/pkg/repository"
+	"flag"
+	"log"
+
+	"go.uber.org/zap"
+)
+
+// RebuildSnapshot regenerates event_snapshot from event_history.
+//
+//	rebuild-snapshot [-user <user_id>] [-key-prefix <prefix>] [-batch-size <n>] [-dry-run]
+func RebuildSnapshot(configFile string, args []string) {
+	flags := flag.NewFlagSet("rebuild-snapshot", flag.ExitOnError)
+	userId := flags.String("user", "", "only rebuild the keys of this user")
+	keyPrefix := flags.String("key-prefix", "", "only rebuild keys starting with this prefix")
+	batchSize := flags.Int("batch-size", 1000, "number of keys rebuilt per transaction, and of history records read per query")
+	dryRun := flags.Bool("dry-run", false, "replay history and report the outcome without changing event_snapshot")
+	_ = flags.Parse(args)
+
+	cfg := config.NewConfig(configFile)
+	logger := initLogger(cfg)
+	defer func() { _ = logger.Sync() }()
+
+	rebuilder := repository.NewSnapshotRebuilder(initDB(cfg))
+	opts := repository.RebuildOptions{UserId: *userId, KeyPrefix: *keyPrefix, BatchSize: *batchSize, DryRun: *dryRun}
+
+	result, err := rebuilder.Rebuild(context.Background(), opts, func(progress repository.RebuildProgress) {
+		logger.Info("rebuilding snapshot",
+			zap.Int("historyRecords", progress.HistoryRecords),
+			zap.Int("snapshots", progress.Snapshots),
+		)
+	})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	logger.Info("snapshot rebuilt",
+		zap.Bool("dryRun", result.DryRun),
+		zap.Int64("removedSnapshots", result.RemovedSnapshots),
+		zap.Int("historyRecords", result.HistoryRecords),
+		zap.Int("keys", result.Keys),
+		zap.Int("snapshots", result.Snapshots),
+	)
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"event-history/pkg/config"
+	"event-history/pkg/repository"
+	"flag"
+	"log"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// VerifySnapshot checks event_snapshot against event_history and prints the
+// drift found as JSON, on stdout unless a report file is given. It exits with
+// status 1 when drift is left unrepaired.
+//
+//	verify [-user <user_id>] [-key-prefix <prefix>] [-batch-size <n>] [-repair] [-report <file>]
+func VerifySnapshot(configFile string, args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	userId := flags.String("user", "", "only verify the keys of this user")
+	keyPrefix := flags.String("key-prefix", "", "only verify keys starting with this prefix")
+	batchSize := flags.Int("batch-size", 1000, "number of history records read and snapshots compared per batch")
+	repair := flags.Bool("repair", false, "make event_snapshot agree with event_history")
+	reportFile := flags.String("report", "", "write the JSON report to this file instead of stdout")
+	_ = flags.Parse(args)
+
+	cfg := config.NewConfig(configFile)
+	logger := initLogger(cfg)
+	defer func() { _ = logger.Sync() }()
+
+	verifier := repository.NewSnapshotVerifier(initDB(cfg))
+	opts := repository.VerifyOptions{UserId: *userId, KeyPrefix: *keyPrefix, BatchSize: *batchSize, Repair: *repair}
+
+	report, err := verifier.Verify(context.Background(), opts)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	logger.Info("snapshot verified",
+		zap.Int("historyRecords", report.HistoryRecords),
+		zap.Int("keys", report.Keys),
+		zap.Int("drifts", len(report.Drifts)),
+		zap.Bool("repaired", report.Repaired),
+	)
+
+	if err := writeReport(*reportFile, report); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if len(report.Drifts) > 0 && !report.Repaired {
+		_ = logger.Sync()
+		os.Exit(1)
+	}
+}
+
+func writeReport(path string, report *repository.VerifyReport) error {
+	out := os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"errors"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"time"
+)
+
+var ErrChecksumMismatch = errors.New("archive segment checksum mismatch")
+
+// Segment is one gzip compressed NDJSON file of history records, all created
+// on the same day and ordered by user and key. Path is relative to the archive
+// directory and SHA256 is the checksum of the compressed file. FirstKey and
+// LastKey bound the keys of the records, so that a read of one key only opens
+// the segments that may hold it.
+type Segment struct {
+	Path       string    `json:"path"`
+	Date       string    `json:"date"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	FirstKey   KeyRef    `json:"first_key"`
+	LastKey    KeyRef    `json:"last_key"`
+	Records    int       `json:"records"`
+	SHA256     string    `json:"sha256"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// KeyRef is a key of a user, ordered by user first.
+type KeyRef struct {
+	UserId string `json:"user_id"`
+	Key    string `json:"key"`
+}
+
+func (kr KeyRef) less(other KeyRef) bool {
+	if kr.UserId != other.UserId {
+		return kr.UserId < other.UserId
+	}
+	return kr.Key < other.Key
+}
+
+// mayHold tells whether the segment can hold records of key. Segments archived
+// before key ranges were recorded have none and may hold any key.
+func (s Segment) mayHold(key KeyRef) bool {
+	if s.FirstKey == (KeyRef{}) && s.LastKey == (KeyRef{}) {
+		return true
+	}
+	return !key.less(s.FirstKey) && !s.LastKey.less(key)
+}
+
+// Manifest lists the segments of an archive ordered by date.
+type Manifest struct {
+	Segments []Segment `json:"segments"`
+}
+
+// Store keeps history records moved out of event_history.
+type Store interface {
+	// Write stores records as segments, split by the day they were created on
+	// and then by key, and adds them to the manifest. Writing the same records again replaces their
+	// segments.
+	Write(records []model.EventHistory) ([]Segment, error)
+	// History reads back the archived records of a key matching the time range
+	// and actions of historyQuery, ordered by sequence. Cursor and Limit are
+	// left to the caller.
+	History(historyQuery *dto.HistoryQuery) ([]model.EventHistory, error)
+	// Verify checks every segment of the manifest against its checksum and
+	// returns the ones that do not match or are missing.
+	Verify() ([]Segment, error)
+}
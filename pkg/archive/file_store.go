@@ -0,0 +1,358 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	manifestFile = "manifest.json"
+	dateLayout   = "2006-01-02"
+	// segmentRecords caps the records of a segment, smaller segments narrow
+	// down the key range each of them covers.
+	segmentRecords = 256
+)
+
+// fileStore keeps segments on local disk as <dir>/<yyyy>/<mm>/<dd>/history-<first offset>-<last offset>.ndjson.gz
+// next to <dir>/manifest.json. The records of a day are sorted by key and cut
+// into segments of up to segmentRecords, so that the segments written together
+// cover disjoint key ranges. Files are written to a temporary name and
+// renamed into place, so readers never see half of one.
+type fileStore struct {
+	dir string
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+func (fs *fileStore) Write(records []model.EventHistory) ([]Segment, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var dates []string
+	byDate := map[string][]model.EventHistory{}
+	for _, record := range records {
+		date := record.CreatedAt.UTC().Format(dateLayout)
+		if _, ok := byDate[date]; !ok {
+			dates = append(dates, date)
+		}
+		byDate[date] = append(byDate[date], record)
+	}
+	sort.Strings(dates)
+
+	var segments []Segment
+	for _, date := range dates {
+		dayRecords := byDate[date]
+		sort.SliceStable(dayRecords, func(i, j int) bool {
+			a, b := keyOf(dayRecords[i]), keyOf(dayRecords[j])
+			if a != b {
+				return a.less(b)
+			}
+			return dayRecords[i].Sequence < dayRecords[j].Sequence
+		})
+
+		for start := 0; start < len(dayRecords); start += segmentRecords {
+			end := start + segmentRecords
+			if end > len(dayRecords) {
+				end = len(dayRecords)
+			}
+
+			segment, err := fs.writeSegment(date, dayRecords[start:end])
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+		}
+	}
+
+	manifest, err := fs.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	manifest.add(segments)
+	if err := fs.writeManifest(manifest); err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+func (fs *fileStore) writeSegment(date string, records []model.EventHistory) (Segment, error) {
+	segment := Segment{
+		Date:       date,
+		FirstKey:   keyOf(records[0]),
+		LastKey:    keyOf(records[len(records)-1]),
+		Records:    len(records),
+		ArchivedAt: fs.now().UTC(),
+	}
+	firstOffset, lastOffset := records[0].Offset, records[0].Offset
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	encoder := json.NewEncoder(writer)
+	for i, record := range records {
+		if record.Offset < firstOffset {
+			firstOffset = record.Offset
+		}
+		if record.Offset > lastOffset {
+			lastOffset = record.Offset
+		}
+		if i == 0 || record.CreatedAt.Before(segment.From) {
+			segment.From = record.CreatedAt.UTC()
+		}
+		if i == 0 || record.CreatedAt.After(segment.To) {
+			segment.To = record.CreatedAt.UTC()
+		}
+
+		// the value is archived inline, the blob it may refer to does not outlive the record
+		record.BlobHash = ""
+		if err := encoder.Encode(record); err != nil {
+			return Segment{}, fmt.Errorf("failed to encode history record %d, error: %w", record.Offset, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return Segment{}, fmt.Errorf("failed to compress segment of %s, error: %w", date, err)
+	}
+
+	day, _ := time.Parse(dateLayout, date)
+	segment.Path = path.Join(day.Format("2006"), day.Format("01"), day.Format("02"),
+		fmt.Sprintf("history-%d-%d.ndjson.gz", firstOffset, lastOffset))
+	segment.SHA256 = checksum(compressed.Bytes())
+
+	if err := writeFile(fs.path(segment.Path), compressed.Bytes()); err != nil {
+		return Segment{}, err
+	}
+	return segment, nil
+}
+
+func (fs *fileStore) History(historyQuery *dto.HistoryQuery) ([]model.EventHistory, error) {
+	manifest, err := fs.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	actions := map[string]bool{}
+	for _, action := range historyQuery.Actions {
+		actions[action] = true
+	}
+
+	key := KeyRef{UserId: historyQuery.UserId, Key: historyQuery.Key}
+	bySequence := map[int64]model.EventHistory{}
+	for _, segment := range manifest.Segments {
+		if !segment.mayHold(key) {
+			continue
+		}
+		if !historyQuery.To.IsZero() && !segment.From.Before(historyQuery.To) {
+			continue
+		}
+		if !historyQuery.From.IsZero() && segment.To.Before(historyQuery.From) {
+			continue
+		}
+
+		records, err := fs.readSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			if record.UserId != historyQuery.UserId || record.Key != historyQuery.Key {
+				continue
+			}
+			if !historyQuery.From.IsZero() && record.CreatedAt.Before(historyQuery.From) {
+				continue
+			}
+			if !historyQuery.To.IsZero() && !record.CreatedAt.Before(historyQuery.To) {
+				continue
+			}
+			if len(actions) > 0 && !actions[record.Action] {
+				continue
+			}
+			// a segment written again after its transaction failed holds the same records
+			bySequence[record.Sequence] = record
+		}
+	}
+
+	history := make([]model.EventHistory, 0, len(bySequence))
+	for _, record := range bySequence {
+		history = append(history, record)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if historyQuery.Descending {
+			return history[i].Sequence > history[j].Sequence
+		}
+		return history[i].Sequence < history[j].Sequence
+	})
+
+	return history, nil
+}
+
+func (fs *fileStore) Verify() ([]Segment, error) {
+	manifest, err := fs.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var broken []Segment
+	for _, segment := range manifest.Segments {
+		if _, err := fs.readChecked(segment); err != nil {
+			broken = append(broken, segment)
+		}
+	}
+	return broken, nil
+}
+
+func (fs *fileStore) readSegment(segment Segment) ([]model.EventHistory, error) {
+	compressed, err := fs.readChecked(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment %s, error: %w", segment.Path, err)
+	}
+	defer reader.Close()
+
+	var records []model.EventHistory
+	decoder := json.NewDecoder(reader)
+	for {
+		var record model.EventHistory
+		if err := decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read segment %s, error: %w", segment.Path, err)
+		}
+
+		// records that remove a key carry no value, which encodes as null
+		if record.RemovesKey() && record.Value == "null" {
+			record.Value = ""
+		}
+		records = append(records, record)
+	}
+}
+
+func (fs *fileStore) readChecked(segment Segment) ([]byte, error) {
+	compressed, err := ioutil.ReadFile(fs.path(segment.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment %s, error: %w", segment.Path, err)
+	}
+
+	if checksum(compressed) != segment.SHA256 {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, segment.Path)
+	}
+	return compressed, nil
+}
+
+func (fs *fileStore) readManifest() (*Manifest, error) {
+	var manifest Manifest
+	raw, err := ioutil.ReadFile(fs.path(manifestFile))
+	if os.IsNotExist(err) {
+		return &manifest, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read archive manifest, error: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to read archive manifest, error: %w", err)
+	}
+	return &manifest, nil
+}
+
+func (fs *fileStore) writeManifest(manifest *Manifest) error {
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive manifest, error: %w", err)
+	}
+	return writeFile(fs.path(manifestFile), raw)
+}
+
+func (fs *fileStore) path(name string) string {
+	return filepath.Join(fs.dir, filepath.FromSlash(name))
+}
+
+// add puts segments into the manifest, replacing the ones with the same path.
+func (m *Manifest) add(segments []Segment) {
+	added := map[string]bool{}
+	for _, segment := range segments {
+		added[segment.Path] = true
+	}
+
+	kept := m.Segments[:0]
+	for _, segment := range m.Segments {
+		if !added[segment.Path] {
+			kept = append(kept, segment)
+		}
+	}
+
+	m.Segments = append(kept, segments...)
+	sort.SliceStable(m.Segments, func(i, j int) bool {
+		if m.Segments[i].Date != m.Segments[j].Date {
+			return m.Segments[i].Date < m.Segments[j].Date
+		}
+		return m.Segments[i].Path < m.Segments[j].Path
+	})
+}
+
+// writeFile writes data to a temporary file that is synced and renamed over name.
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create %s, error: %w", filepath.Dir(name), err)
+	}
+
+	tmp := name + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s, error: %w", tmp, err)
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write %s, error: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("failed to move %s into place, error: %w", name, err)
+	}
+	return nil
+}
+
+func keyOf(record model.EventHistory) KeyRef {
+	return KeyRef{UserId: record.UserId, Key: record.Key}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewFileStore keeps the archive in dir, which is created on the first write.
+func NewFileStore(dir string) Store {
+	return &fileStore{
+		dir: dir,
+		now: time.Now,
+	}
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"errors"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	day := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	records := []model.EventHistory{
+		{Key: "name", UserId: "user1", Value: `"john"`, Action: model.CreateAction, Version: 1, Sequence: 1, Offset: 7, CreatedAt: day},
+		{Key: "age", UserId: "user1", Value: `30`, Action: model.CreateAction, Version: 1, Sequence: 1, Offset: 8, CreatedAt: day.Add(time.Hour)},
+		{Key: "name", UserId: "user1", Value: `"jane"`, Action: model.UpdateAction, Version: 2, Sequence: 2, Offset: 9, CreatedAt: day.Add(24 * time.Hour), BlobHash: "abc"},
+		{Key: "name", UserId: "user1", Action: model.DeleteAction, Version: 3, Sequence: 3, Offset: 10, CreatedAt: day.Add(25 * time.Hour)},
+	}
+	store := NewFileStore(dir)
+
+	segments, err := store.Write(records)
+
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	assert.Equal(t, "2021/03/01/history-7-8.ndjson.gz", segments[0].Path)
+	assert.Equal(t, 2, segments[0].Records)
+	assert.Equal(t, "2021/03/02/history-9-10.ndjson.gz", segments[1].Path)
+
+	_, err = store.Write(records[2:])
+	require.NoError(t, err)
+	history, err := store.History(&dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: "user1"}, Descending: true})
+
+	require.NoError(t, err)
+	assert.Equal(t, []model.EventHistory{records[3], {
+		Key: "name", UserId: "user1", Value: `"jane"`, Action: model.UpdateAction, Version: 2, Sequence: 2, Offset: 9, CreatedAt: day.Add(24 * time.Hour),
+	}, records[0]}, history)
+
+	history, err = store.History(&dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: "user1"}, From: day.Add(time.Hour)})
+
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "2021", "03", "01", "history-7-8.ndjson.gz"), []byte("tampered"), 0644))
+
+	broken, err := store.Verify()
+
+	require.NoError(t, err)
+	assert.Equal(t, []Segment{segments[0]}, broken)
+	_, err = store.History(&dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: "user1"}})
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+}
+
+func TestFileStore_History_opensMatchingSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	day := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	var records []model.EventHistory
+	for i := 0; i < 2*segmentRecords; i++ {
+		records = append(records, model.EventHistory{
+			Key: fmt.Sprintf("key-%03d", i), UserId: "user1", Value: `1`, Action: model.CreateAction,
+			Version: 1, Sequence: 1, Offset: int64(2*segmentRecords - i), CreatedAt: day,
+		})
+	}
+	store := NewFileStore(dir)
+
+	segments, err := store.Write(records)
+
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	assert.Equal(t, KeyRef{UserId: "user1", Key: "key-000"}, segments[0].FirstKey)
+	assert.Equal(t, KeyRef{UserId: "user1", Key: "key-255"}, segments[0].LastKey)
+	assert.Equal(t, KeyRef{UserId: "user1", Key: "key-256"}, segments[1].FirstKey)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(segments[1].Path)), []byte("tampered"), 0644))
+	history, err := store.History(&dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "key-007", UserId: "user1"}})
+
+	require.NoError(t, err, "the segment of other keys is not opened")
+	require.Len(t, history, 1)
+	assert.Equal(t, int64(2*segmentRecords-7), history[0].Offset)
+}
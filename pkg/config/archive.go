@@ -0,0 +1,16 @@
+package config
+
+type ArchiveConfig struct {
+	dir string
+}
+
+func newArchiveConfig() ArchiveConfig {
+	return ArchiveConfig{
+		dir: getString("ARCHIVE_DIR", ""),
+	}
+}
+
+// GetDir is where archived history is kept, empty leaves archiving off.
+func (ac ArchiveConfig) GetDir() string {
+	return ac.dir
+}
@@ -0,0 +1,16 @@
+package config
+
+type BlobStoreConfig struct {
+	thresholdInBytes int
+}
+
+func newBlobStoreConfig() BlobStoreConfig {
+	return BlobStoreConfig{
+		thresholdInBytes: getInt("BLOB_THRESHOLD_IN_BYTES", 64*1024),
+	}
+}
+
+// GetThresholdInBytes is the size above which values go to the blob store, zero keeps every value inline.
+func (bc BlobStoreConfig) GetThresholdInBytes() int {
+	return bc.thresholdInBytes
+}
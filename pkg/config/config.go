@@ -10,6 +10,11 @@ type Config struct {
 	logConfig           LogConfig
 	logFileConfig       LogFileConfig
 	httpServerConfig    HTTPServerConfig
+	blobStoreConfig     BlobStoreConfig
+	reaperConfig        ReaperConfig
+	retentionConfig     RetentionConfig
+	archiveConfig       ArchiveConfig
+	partitionConfig     PartitionConfig
 	tickerIntervalInSec int
 }
 
@@ -29,6 +34,26 @@ func (config Config) GetLogFileConfig() LogFileConfig {
 	return config.logFileConfig
 }
 
+func (config Config) GetBlobStoreConfig() BlobStoreConfig {
+	return config.blobStoreConfig
+}
+
+func (config Config) GetReaperConfig() ReaperConfig {
+	return config.reaperConfig
+}
+
+func (config Config) GetRetentionConfig() RetentionConfig {
+	return config.retentionConfig
+}
+
+func (config Config) GetArchiveConfig() ArchiveConfig {
+	return config.archiveConfig
+}
+
+func (config Config) GetPartitionConfig() PartitionConfig {
+	return config.partitionConfig
+}
+
 func NewConfig(configFile string) Config {
 	viper.AutomaticEnv()
 
@@ -44,5 +69,10 @@ func NewConfig(configFile string) Config {
 		logConfig:           newLogConfig(),
 		logFileConfig:       newLogFileConfig(),
 		httpServerConfig:    newHTTPServerConfig(),
+		blobStoreConfig:     newBlobStoreConfig(),
+		reaperConfig:        newReaperConfig(),
+		retentionConfig:     newRetentionConfig(),
+		archiveConfig:       newArchiveConfig(),
+		partitionConfig:     newPartitionConfig(),
 	}
 }
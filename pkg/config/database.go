@@ -1,32 +1,195 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	PostgresDriver = "postgres"
+	MySQLDriver    = "mysql"
+	SQLiteDriver   = "sqlite"
+	MemoryDriver   = "memory"
+)
 
 type DBConfig struct {
+	driver        string
 	host          string
 	port          int
 	name          string
 	user          string
 	password      string
+	path          string
 	migrationPath string
+
+	replicas                        []string
+	replicaHealthCheckIntervalInSec int
+	readAfterWriteWindowInMs        int
+
+	maxOpenConns         int
+	maxIdleConns         int
+	connMaxLifetimeInSec int
+	statementTimeoutInMs int
+	readTimeoutInMs      int
+	writeTimeoutInMs     int
+	batchTimeoutInMs     int
+
+	retryMaxAttempts   int
+	retryBaseDelayInMs int
+	retryMaxDelayInMs  int
 }
 
+// Address is the address of the primary. A statement timeout is passed on to
+// postgres as statement_timeout and to mysql as max_execution_time, which only
+// bounds selects, sqlite has none.
 func (db *DBConfig) Address() string {
+	switch db.driver {
+	case SQLiteDriver:
+		return fmt.Sprintf("file:%s?_busy_timeout=5000", db.path)
+	case MySQLDriver:
+		return db.withStatementTimeout(fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true", db.user, db.password, db.host, db.port, db.name))
+	}
+
 	// host=localhost user=gorm password=gorm dbname=gorm port=9920 sslmode=disable
-	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable", db.host, db.user, db.password, db.name, db.port)
+	return db.withStatementTimeout(fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable", db.host, db.user, db.password, db.name, db.port))
+}
+
+// withStatementTimeout adds the statement timeout to a mysql DSN, or to a
+// postgres DSN in either its keyword/value or its URL form.
+func (db *DBConfig) withStatementTimeout(address string) string {
+	if db.statementTimeoutInMs <= 0 || db.driver == SQLiteDriver {
+		return address
+	}
+
+	if db.driver == MySQLDriver {
+		return address + queryParam(address, "max_execution_time", db.statementTimeoutInMs)
+	}
+	if strings.HasPrefix(address, "postgres://") || strings.HasPrefix(address, "postgresql://") {
+		return address + queryParam(address, "statement_timeout", db.statementTimeoutInMs)
+	}
+	return fmt.Sprintf("%s statement_timeout=%d", address, db.statementTimeoutInMs)
+}
+
+func queryParam(address, name string, value int) string {
+	separator := "?"
+	if strings.Contains(address, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s=%d", separator, name, value)
+}
+
+func (db *DBConfig) Driver() string {
+	return db.driver
 }
 
 func (db *DBConfig) MigrationPath() string {
 	return db.migrationPath
 }
 
+// Replicas are the addresses of the read replicas, in the format Address has for the driver. They carry the
+// statement timeout of the primary as well.
+func (db *DBConfig) Replicas() []string {
+	replicas := make([]string, 0, len(db.replicas))
+	for _, replica := range db.replicas {
+		replicas = append(replicas, db.withStatementTimeout(replica))
+	}
+	return replicas
+}
+
+// ReplicaHealthCheckInterval is how often the replicas are pinged, always positive when there are replicas.
+func (db *DBConfig) ReplicaHealthCheckInterval() time.Duration {
+	return time.Duration(db.replicaHealthCheckIntervalInSec) * time.Second
+}
+
+// ReadAfterWriteWindow is how long the reads of a user stay on the primary after they wrote.
+func (db *DBConfig) ReadAfterWriteWindow() time.Duration {
+	return time.Duration(db.readAfterWriteWindowInMs) * time.Millisecond
+}
+
+// MaxOpenConns caps the open connections of a pool, zero leaves them unlimited.
+func (db *DBConfig) MaxOpenConns() int {
+	return db.maxOpenConns
+}
+
+// MaxIdleConns is how many idle connections a pool keeps, zero keeps none.
+func (db *DBConfig) MaxIdleConns() int {
+	return db.maxIdleConns
+}
+
+// ConnMaxLifetime is how long a connection is reused for, zero reuses it forever.
+func (db *DBConfig) ConnMaxLifetime() time.Duration {
+	return time.Duration(db.connMaxLifetimeInSec) * time.Second
+}
+
+// ReadTimeout bounds a read of a key or its history.
+func (db *DBConfig) ReadTimeout() time.Duration {
+	return time.Duration(db.readTimeoutInMs) * time.Millisecond
+}
+
+// WriteTimeout bounds a write of a key.
+func (db *DBConfig) WriteTimeout() time.Duration {
+	return time.Duration(db.writeTimeoutInMs) * time.Millisecond
+}
+
+// BatchTimeout bounds a batch of writes.
+func (db *DBConfig) BatchTimeout() time.Duration {
+	return time.Duration(db.batchTimeoutInMs) * time.Millisecond
+}
+
+// RetryMaxAttempts is how many times an operation that failed with a transient error is tried in all, 1 turns retries off.
+func (db *DBConfig) RetryMaxAttempts() int {
+	return db.retryMaxAttempts
+}
+
+// RetryBaseDelay is the upper bound of the delay before the first retry, it doubles with every retry.
+func (db *DBConfig) RetryBaseDelay() time.Duration {
+	return time.Duration(db.retryBaseDelayInMs) * time.Millisecond
+}
+
+// RetryMaxDelay caps the delay before a retry.
+func (db *DBConfig) RetryMaxDelay() time.Duration {
+	return time.Duration(db.retryMaxDelayInMs) * time.Millisecond
+}
+
 func newDBConfig() DBConfig {
+	var replicas []string
+	for _, replica := range strings.Split(getString("DB_REPLICAS", ""), ",") {
+		if replica = strings.TrimSpace(replica); replica != "" {
+			replicas = append(replicas, replica)
+		}
+	}
+
+	healthCheckInterval := getInt("DB_REPLICA_HEALTH_CHECK_INTERVAL_IN_SEC", 5)
+	if len(replicas) > 0 && healthCheckInterval <= 0 {
+		log.Fatalf("DB_REPLICA_HEALTH_CHECK_INTERVAL_IN_SEC must be positive with DB_REPLICAS set, got %d", healthCheckInterval)
+	}
+
 	return DBConfig{
+		driver:        getString("DB_DRIVER", PostgresDriver),
 		host:          getString("DB_HOST", "localhost"),
 		port:          getInt("DB_PORT", 5432),
 		name:          getString("DB_NAME", "postgres"),
 		user:          getString("DB_USER", "postgres"),
 		password:      getString("DB_PASSWORD", "pwd"),
+		path:          getString("DB_PATH", "event_history.db"),
 		migrationPath: getString("MIGRATION_PATH", ""),
+
+		replicas:                        replicas,
+		replicaHealthCheckIntervalInSec: healthCheckInterval,
+		readAfterWriteWindowInMs:        getInt("DB_READ_AFTER_WRITE_WINDOW_IN_MS", 2000),
+
+		maxOpenConns:         getInt("DB_MAX_OPEN_CONNS", 0),
+		maxIdleConns:         getInt("DB_MAX_IDLE_CONNS", 2),
+		connMaxLifetimeInSec: getInt("DB_CONN_MAX_LIFETIME_IN_SEC", 0),
+		statementTimeoutInMs: getInt("DB_STATEMENT_TIMEOUT_IN_MS", 0),
+		readTimeoutInMs:      getInt("DB_READ_TIMEOUT_IN_MS", 1000),
+		writeTimeoutInMs:     getInt("DB_WRITE_TIMEOUT_IN_MS", 1000),
+		batchTimeoutInMs:     getInt("DB_BATCH_TIMEOUT_IN_MS", 1000),
+
+		retryMaxAttempts:   getInt("DB_RETRY_MAX_ATTEMPTS", 3),
+		retryBaseDelayInMs: getInt("DB_RETRY_BASE_DELAY_IN_MS", 50),
+		retryMaxDelayInMs:  getInt("DB_RETRY_MAX_DELAY_IN_MS", 1000),
 	}
 }
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBConfig_Replicas_statementTimeout(t *testing.T) {
+	tests := []struct {
+		driver   string
+		replica  string
+		expected string
+	}{
+		{PostgresDriver, "host=replica1 user=postgres dbname=postgres port=5432", "host=replica1 user=postgres dbname=postgres port=5432 statement_timeout=500"},
+		{PostgresDriver, "postgres://postgres@replica1:5432/postgres", "postgres://postgres@replica1:5432/postgres?statement_timeout=500"},
+		{PostgresDriver, "postgres://postgres@replica1:5432/postgres?sslmode=disable", "postgres://postgres@replica1:5432/postgres?sslmode=disable&statement_timeout=500"},
+		{MySQLDriver, "root:pwd@tcp(replica1:3306)/events?parseTime=true", "root:pwd@tcp(replica1:3306)/events?parseTime=true&max_execution_time=500"},
+		{MySQLDriver, "root:pwd@tcp(replica1:3306)/events", "root:pwd@tcp(replica1:3306)/events?max_execution_time=500"},
+		{SQLiteDriver, "file:replica.db?mode=ro", "file:replica.db?mode=ro"},
+	}
+
+	for _, tt := range tests {
+		db := DBConfig{driver: tt.driver, replicas: []string{tt.replica}, statementTimeoutInMs: 500}
+		assert.Equal(t, []string{tt.expected}, db.Replicas(), tt.replica)
+	}
+
+	db := DBConfig{driver: PostgresDriver, replicas: []string{"host=replica1"}}
+	assert.Equal(t, []string{"host=replica1"}, db.Replicas(), "no timeout, no parameter")
+}
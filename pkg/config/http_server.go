@@ -7,6 +7,7 @@ type HTTPServerConfig struct {
 	port             string
 	readTimoutInSec  int
 	writeTimoutInSec int
+	adminAddress     string
 }
 
 func newHTTPServerConfig() HTTPServerConfig {
@@ -15,6 +16,7 @@ func newHTTPServerConfig() HTTPServerConfig {
 		port:             getString("HTTP_SERVER_PORT", "8080"),
 		readTimoutInSec:  getInt("HTTP_SERVER_READ_TIMEOUT_IN_SEC"),
 		writeTimoutInSec: getInt("HTTP_SERVER_WRITE_TIMEOUT_IN_SEC"),
+		adminAddress:     getString("HTTP_SERVER_ADMIN_ADDRESS", "localhost:8081"),
 	}
 }
 
@@ -22,6 +24,12 @@ func (sc HTTPServerConfig) GetAddress() string {
 	return fmt.Sprintf(":%s", sc.port)
 }
 
+// GetAdminAddress is where the admin endpoints are served, only on the loopback
+// interface by default. Empty turns the admin listener off.
+func (sc HTTPServerConfig) GetAdminAddress() string {
+	return sc.adminAddress
+}
+
 func (sc HTTPServerConfig) GetReadTimeout() int {
 	return sc.readTimoutInSec
 }
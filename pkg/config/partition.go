@@ -0,0 +1,23 @@
+package config
+
+type PartitionConfig struct {
+	aheadMonths  int
+	retainMonths int
+}
+
+func newPartitionConfig() PartitionConfig {
+	return PartitionConfig{
+		aheadMonths:  getInt("PARTITION_AHEAD_MONTHS", 3),
+		retainMonths: getInt("PARTITION_RETAIN_MONTHS", 0),
+	}
+}
+
+// GetAheadMonths is how many months of event_history partitions are created ahead of the current one.
+func (pc PartitionConfig) GetAheadMonths() int {
+	return pc.aheadMonths
+}
+
+// GetRetainMonths is how many months of past partitions are kept, zero keeps all of them.
+func (pc PartitionConfig) GetRetainMonths() int {
+	return pc.retainMonths
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+type ReaperConfig struct {
+	intervalInSec int
+	batchSize     int
+}
+
+func newReaperConfig() ReaperConfig {
+	batchSize := getInt("REAPER_BATCH_SIZE", 100)
+	if batchSize <= 0 {
+		log.Fatalf("REAPER_BATCH_SIZE must be positive, got %d", batchSize)
+	}
+
+	return ReaperConfig{
+		intervalInSec: getInt("REAPER_INTERVAL_IN_SEC", 60),
+		batchSize:     batchSize,
+	}
+}
+
+// GetInterval is how often expired keys are reaped, zero disables the reaper.
+func (rc ReaperConfig) GetInterval() time.Duration {
+	return time.Duration(rc.intervalInSec) * time.Second
+}
+
+// GetBatchSize is how many keys are expired per transaction, it is always positive.
+func (rc ReaperConfig) GetBatchSize() int {
+	return rc.batchSize
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// RetentionPolicy keeps the last KeepVersions history records of the keys
+// starting with KeyPrefix and every record younger than KeepDays, zero leaves a
+// bound out.
+type RetentionPolicy struct {
+	KeyPrefix    string `json:"key_prefix"`
+	KeepVersions int    `json:"keep_versions"`
+	KeepDays     int    `json:"keep_days"`
+}
+
+type RetentionConfig struct {
+	keepVersions         int
+	keepDays             int
+	overrides            []RetentionPolicy
+	compactIntervalInSec int
+}
+
+func newRetentionConfig() RetentionConfig {
+	var overrides []RetentionPolicy
+	if raw := getString("RETENTION_OVERRIDES"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+			log.Fatalf("RETENTION_OVERRIDES must be a JSON list of policies: %v", err)
+		}
+	}
+
+	return RetentionConfig{
+		keepVersions:         getInt("RETENTION_KEEP_VERSIONS", 0),
+		keepDays:             getInt("RETENTION_KEEP_DAYS", 0),
+		overrides:            overrides,
+		compactIntervalInSec: getInt("RETENTION_COMPACT_INTERVAL_IN_SEC", 0),
+	}
+}
+
+// GetDefaultPolicy applies to the keys no override matches.
+func (rc RetentionConfig) GetDefaultPolicy() RetentionPolicy {
+	return RetentionPolicy{KeepVersions: rc.keepVersions, KeepDays: rc.keepDays}
+}
+
+// GetOverrides are policies for key prefixes, the longest matching prefix wins.
+func (rc RetentionConfig) GetOverrides() []RetentionPolicy {
+	return rc.overrides
+}
+
+// GetCompactInterval is how often the HTTP server compacts history, zero disables it.
+func (rc RetentionConfig) GetCompactInterval() time.Duration {
+	return time.Duration(rc.compactIntervalInSec) * time.Second
+}
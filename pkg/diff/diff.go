@@ -0,0 +1,53 @@
+// Package diff computes what changed between two values of a key. Strings are
+// compared line by line, or character by character when they are single lines,
+// every other JSON value is compared structurally into a JSON Patch.
+package diff
+
+import (
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"strings"
+)
+
+const (
+	JSONPatchFormat = "json-patch"
+	TextFormat      = "text"
+)
+
+// Result holds either a JSON Patch (RFC 6902) or text edits, as told by Format.
+type Result struct {
+	Format string      `json:"format"`
+	Patch  []Operation `json:"patch,omitempty"`
+	Text   []Edit      `json:"text,omitempty"`
+}
+
+// Diff compares two values. A text diff is only made when both are strings.
+func Diff(from, to model.JSONValue) (*Result, error) {
+	if from.Type() == model.StringValue && to.Type() == model.StringValue {
+		var fromText, toText string
+		if err := unmarshal(from, &fromText); err != nil {
+			return nil, err
+		}
+		if err := unmarshal(to, &toText); err != nil {
+			return nil, err
+		}
+
+		if strings.Contains(fromText, "\n") || strings.Contains(toText, "\n") {
+			return &Result{Format: TextFormat, Text: Lines(fromText, toText)}, nil
+		}
+		return &Result{Format: TextFormat, Text: Characters(fromText, toText)}, nil
+	}
+
+	patch, err := JSONPatch(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Format: JSONPatchFormat, Patch: patch}, nil
+}
+
+func unmarshal(value model.JSONValue, v interface{}) error {
+	if err := decode(value, v); err != nil {
+		return fmt.Errorf("value is not valid JSON: %.50s, error: %w", string(value), err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPatch(t *testing.T) {
+	patch, err := JSONPatch(
+		`{"name":"john","age":30,"tags":["a","b","c"],"address":{"city":"Pune","zip":"411001"},"a/b":1}`,
+		`{"name":"john","age":30.0,"tags":["a","x"],"address":{"city":"Mumbai"},"email":null,"a/b":2}`,
+	)
+
+	require.NoError(t, err)
+	assert.Equal(t, []Operation{
+		{Op: ReplaceOperation, Path: "/a~1b", Value: json.RawMessage(`2`)},
+		{Op: RemoveOperation, Path: "/address/zip"},
+		{Op: ReplaceOperation, Path: "/address/city", Value: json.RawMessage(`"Mumbai"`)},
+		{Op: AddOperation, Path: "/email", Value: json.RawMessage(`null`)},
+		{Op: ReplaceOperation, Path: "/tags/1", Value: json.RawMessage(`"x"`)},
+		{Op: RemoveOperation, Path: "/tags/2"},
+	}, patch)
+}
+
+func TestJSONPatch_differentTypes(t *testing.T) {
+	patch, err := JSONPatch(`[1,2]`, `{"count":2}`)
+
+	require.NoError(t, err)
+	assert.Equal(t, []Operation{{Op: ReplaceOperation, Path: "", Value: json.RawMessage(`{"count":2}`)}}, patch)
+
+	patch, err = JSONPatch(`{"count":2}`, `{"count":2}`)
+
+	require.NoError(t, err)
+	assert.Empty(t, patch)
+}
+
+func TestDiff_text(t *testing.T) {
+	result, err := Diff(`"kitten"`, `"sitting"`)
+
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Format: TextFormat, Text: []Edit{
+		{Op: DeleteEdit, Text: "k"},
+		{Op: InsertEdit, Text: "s"},
+		{Op: EqualEdit, Text: "itt"},
+		{Op: DeleteEdit, Text: "e"},
+		{Op: InsertEdit, Text: "i"},
+		{Op: EqualEdit, Text: "n"},
+		{Op: InsertEdit, Text: "g"},
+	}}, result)
+
+	result, err = Diff(`"one\ntwo\nthree\n"`, `"one\n2\nthree\nfour\n"`)
+
+	require.NoError(t, err)
+	assert.Equal(t, []Edit{
+		{Op: EqualEdit, Text: "one\n"},
+		{Op: DeleteEdit, Text: "two\n"},
+		{Op: InsertEdit, Text: "2\n"},
+		{Op: EqualEdit, Text: "three\n"},
+		{Op: InsertEdit, Text: "four\n"},
+	}, result.Text)
+}
+
+func TestDiff_jsonPatchForMixedTypes(t *testing.T) {
+	result, err := Diff(`"30"`, `30`)
+
+	require.NoError(t, err)
+	assert.Equal(t, JSONPatchFormat, result.Format)
+	assert.Equal(t, []Operation{{Op: ReplaceOperation, Path: "", Value: json.RawMessage(`30`)}}, result.Patch)
+}
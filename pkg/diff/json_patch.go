@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"event-history/pkg/eventinfo/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	AddOperation     = "add"
+	RemoveOperation  = "remove"
+	ReplaceOperation = "replace"
+)
+
+// Operation is one JSON Patch operation. Value is left out of removes.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch returns the operations that turn from into to. Objects are compared
+// key by key in key order and arrays index by index, anything else that differs
+// is replaced as a whole. Numbers compare by value, so 1 and 1.0 are equal.
+func JSONPatch(from, to model.JSONValue) ([]Operation, error) {
+	var fromDoc, toDoc interface{}
+	if err := unmarshal(from, &fromDoc); err != nil {
+		return nil, err
+	}
+	if err := unmarshal(to, &toDoc); err != nil {
+		return nil, err
+	}
+
+	patch := []Operation{}
+	return diffNode(patch, "", fromDoc, toDoc)
+}
+
+func diffNode(patch []Operation, path string, from, to interface{}) ([]Operation, error) {
+	switch fromNode := from.(type) {
+	case map[string]interface{}:
+		if toNode, ok := to.(map[string]interface{}); ok {
+			return diffObject(patch, path, fromNode, toNode)
+		}
+	case []interface{}:
+		if toNode, ok := to.([]interface{}); ok {
+			return diffArray(patch, path, fromNode, toNode)
+		}
+	default:
+		if equalScalar(from, to) {
+			return patch, nil
+		}
+	}
+
+	return appendOperation(patch, ReplaceOperation, path, to)
+}
+
+func diffObject(patch []Operation, path string, from, to map[string]interface{}) ([]Operation, error) {
+	var err error
+	for _, key := range sortedKeys(from) {
+		if _, ok := to[key]; !ok {
+			patch = append(patch, Operation{Op: RemoveOperation, Path: path + "/" + escapePointer(key)})
+		}
+	}
+
+	for _, key := range sortedKeys(to) {
+		fromValue, ok := from[key]
+		if !ok {
+			patch, err = appendOperation(patch, AddOperation, path+"/"+escapePointer(key), to[key])
+		} else {
+			patch, err = diffNode(patch, path+"/"+escapePointer(key), fromValue, to[key])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return patch, nil
+}
+
+// diffArray compares the common part index by index, then appends the new
+// elements or removes the surplus ones from the end so that indexes stay valid.
+func diffArray(patch []Operation, path string, from, to []interface{}) ([]Operation, error) {
+	var err error
+	for i := 0; i < len(from) && i < len(to); i++ {
+		if patch, err = diffNode(patch, path+"/"+strconv.Itoa(i), from[i], to[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := len(from); i < len(to); i++ {
+		if patch, err = appendOperation(patch, AddOperation, path+"/"+strconv.Itoa(i), to[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := len(from) - 1; i >= len(to); i-- {
+		patch = append(patch, Operation{Op: RemoveOperation, Path: path + "/" + strconv.Itoa(i)})
+	}
+	return patch, nil
+}
+
+func appendOperation(patch []Operation, op, path string, value interface{}) ([]Operation, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(patch, Operation{Op: op, Path: path, Value: raw}), nil
+}
+
+func equalScalar(from, to interface{}) bool {
+	fromNumber, fromIsNumber := from.(json.Number)
+	toNumber, toIsNumber := to.(json.Number)
+	if fromIsNumber && toIsNumber {
+		if fromNumber == toNumber {
+			return true
+		}
+
+		fromFloat, fromErr := fromNumber.Float64()
+		toFloat, toErr := toNumber.Float64()
+		return fromErr == nil && toErr == nil && fromFloat == toFloat
+	}
+
+	return from == to
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escapes a key for use as a JSON Pointer (RFC 6901) segment.
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// decode keeps numbers as json.Number so that they are written back as they were.
+func decode(value model.JSONValue, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"strings"
+)
+
+const (
+	EqualEdit  = "equal"
+	InsertEdit = "insert"
+	DeleteEdit = "delete"
+)
+
+// maxDiffCells bounds the size of the table the longest common subsequence is
+// computed on. A changed region larger than that is reported as one delete
+// followed by one insert.
+const maxDiffCells = 4 * 1024 * 1024
+
+// Edit is a run of text that is kept, inserted or deleted.
+type Edit struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines diffs two texts line by line, every line keeps its trailing newline.
+func Lines(from, to string) []Edit {
+	return diffTokens(strings.SplitAfter(from, "\n"), strings.SplitAfter(to, "\n"))
+}
+
+// Characters diffs two texts character by character.
+func Characters(from, to string) []Edit {
+	return diffTokens(splitRunes(from), splitRunes(to))
+}
+
+func splitRunes(text string) []string {
+	tokens := make([]string, 0, len(text))
+	for _, r := range text {
+		tokens = append(tokens, string(r))
+	}
+	return tokens
+}
+
+// diffTokens strips the common prefix and suffix and runs a longest common
+// subsequence over what is left.
+func diffTokens(from, to []string) []Edit {
+	edits := []Edit{}
+
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	edits = appendEdit(edits, EqualEdit, from[:prefix]...)
+	from, to = from[prefix:], to[prefix:]
+
+	suffix := 0
+	for suffix < len(from) && suffix < len(to) && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	common := from[len(from)-suffix:]
+	from, to = from[:len(from)-suffix], to[:len(to)-suffix]
+
+	if len(from)*len(to) > maxDiffCells {
+		edits = appendEdit(edits, DeleteEdit, from...)
+		edits = appendEdit(edits, InsertEdit, to...)
+	} else {
+		edits = diffMiddle(edits, from, to)
+	}
+
+	return appendEdit(edits, EqualEdit, common...)
+}
+
+func diffMiddle(edits []Edit, from, to []string) []Edit {
+	// lcs[i][j] is the length of the longest common subsequence of from[i:] and to[j:].
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			edits = appendEdit(edits, EqualEdit, from[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = appendEdit(edits, DeleteEdit, from[i])
+			i++
+		default:
+			edits = appendEdit(edits, InsertEdit, to[j])
+			j++
+		}
+	}
+	edits = appendEdit(edits, DeleteEdit, from[i:]...)
+	return appendEdit(edits, InsertEdit, to[j:]...)
+}
+
+// appendEdit merges tokens into the last edit when it has the same op.
+func appendEdit(edits []Edit, op string, tokens ...string) []Edit {
+	text := strings.Join(tokens, "")
+	if text == "" {
+		return edits
+	}
+
+	if last := len(edits) - 1; last >= 0 && edits[last].Op == op {
+		edits[last].Text += text
+		return edits
+	}
+	return append(edits, Edit{Op: op, Text: text})
+}
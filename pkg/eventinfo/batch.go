@@ -0,0 +1,47 @@
+package eventinfo
+
+import (
+	"crypto/rand"
+	"errors"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+)
+
+var ErrInvalidBatch = errors.New("invalid batch")
+
+func validateBatch(operations []dto.BatchOperation) error {
+	if len(operations) == 0 {
+		return fmt.Errorf("batch has no operations: %w", ErrInvalidBatch)
+	}
+
+	if len(operations) > dto.MaxBatchOperations {
+		return fmt.Errorf("batch has %d operations, at most %d are allowed: %w", len(operations), dto.MaxBatchOperations, ErrInvalidBatch)
+	}
+
+	for i, operation := range operations {
+		switch operation.Action {
+		case model.CreateAction, model.UpdateAction, model.DeleteAction:
+		default:
+			return fmt.Errorf("operation %d has unknown action %q: %w", i, operation.Action, ErrInvalidBatch)
+		}
+
+		if operation.Key == "" || operation.UserId == "" {
+			return fmt.Errorf("operation %d needs a key and a user_id: %w", i, ErrInvalidBatch)
+		}
+	}
+
+	return nil
+}
+
+// newBatchId returns a random (version 4) UUID.
+func newBatchId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
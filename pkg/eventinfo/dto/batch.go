@@ -0,0 +1,46 @@
+package dto
+
+import "event-history/pkg/eventinfo/model"
+
+const MaxBatchOperations = 100
+
+// BatchOperation is one create, update or delete of a batch. Like for single
+// writes a non zero Version makes an update or delete conditional.
+type BatchOperation struct {
+	Action  string          `json:"action"`
+	Key     string          `json:"key"`
+	UserId  string          `json:"user_id"`
+	Value   model.JSONValue `json:"value"`
+	Version int64           `json:"version"`
+}
+
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchEventResponse struct {
+	Key      string `json:"key"`
+	UserId   string `json:"user_id"`
+	Event    string `json:"event"`
+	Version  int64  `json:"version"`
+	Sequence int64  `json:"sequence"`
+}
+
+type BatchResult struct {
+	BatchId string               `json:"batch_id"`
+	Events  []BatchEventResponse `json:"events"`
+}
+
+func NewBatchResult(batchId string, history []model.EventHistory) *BatchResult {
+	events := make([]BatchEventResponse, 0, len(history))
+	for _, event := range history {
+		events = append(events, BatchEventResponse{
+			Key:      event.Key,
+			UserId:   event.UserId,
+			Event:    event.Action,
+			Version:  event.Version,
+			Sequence: event.Sequence,
+		})
+	}
+	return &BatchResult{BatchId: batchId, Events: events}
+}
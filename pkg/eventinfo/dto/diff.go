@@ -0,0 +1,17 @@
+package dto
+
+import "event-history/pkg/diff"
+
+// DiffQuery compares the values a key held at versions From and To.
+type DiffQuery struct {
+	EventQuery
+	From int64
+	To   int64
+}
+
+type DiffResponse struct {
+	Key  string `json:"key"`
+	From int64  `json:"from"`
+	To   int64  `json:"to"`
+	*diff.Result
+}
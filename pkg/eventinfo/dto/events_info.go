@@ -2,40 +2,99 @@ package dto
 
 import (
 	"event-history/pkg/eventinfo/model"
+	"time"
+)
+
+const (
+	DefaultHistoryLimit = 100
+	MaxHistoryLimit     = 1000
 )
 
 type EventQuery struct {
 	Key    string
 	UserId string
+	// Version makes a delete conditional on the current version of the key, zero deletes unconditionally.
+	Version int64
+}
+
+// HistoryQuery narrows a key's history. From is inclusive, To is exclusive and
+// zero values leave the bound open. A Limit of zero returns every matching record.
+// IncludeArchived also reads the records moved to the history archive.
+type HistoryQuery struct {
+	EventQuery
+	From            time.Time
+	To              time.Time
+	Actions         []string
+	Descending      bool
+	Limit           int
+	Cursor          string
+	IncludeArchived bool
+}
+
+// CompareAndSwapRequest asks to set Value only if the key currently holds Expected.
+type CompareAndSwapRequest struct {
+	Expected model.JSONValue `json:"expected"`
+	Value    model.JSONValue `json:"value"`
+}
+
+// RevertQuery picks the history record a key is reverted to, either by its
+// sequence number or as the latest record at or before At.
+type RevertQuery struct {
+	EventQuery
+	Sequence int64
+	At       time.Time
+}
+
+// RevertRequest is the body of a revert, exactly one of Sequence and At is set.
+type RevertRequest struct {
+	Sequence int64  `json:"sequence"`
+	At       string `json:"at"`
 }
 
 type EventResponse struct {
-	Key   string
-	Value string
+	Key       string
+	Value     model.JSONValue
+	ValueType string
+	Version   int64
+	ExpiresAt *time.Time
 }
 
 // mapping and formatting happens here
 func NewEventResponse(eventSnapshot *model.EventSnapshot) *EventResponse {
 	return &EventResponse{
-		Key:   eventSnapshot.Key,
-		Value: eventSnapshot.Value,
+		Key:       eventSnapshot.Key,
+		Value:     eventSnapshot.Value,
+		ValueType: eventSnapshot.ValueType,
+		Version:   eventSnapshot.Version,
+		ExpiresAt: eventSnapshot.ExpiresAt,
 	}
 }
 
 type Data struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key       string          `json:"key"`
+	Value     model.JSONValue `json:"value"`
+	ValueType string          `json:"value_type,omitempty"`
 }
 
 type EventHistoryResponse struct {
-	Data  Data   `json:"data"`
-	Event string `json:"event"`
+	Data          Data   `json:"data"`
+	Event         string `json:"event"`
+	Sequence      int64  `json:"sequence"`
+	Version       int64  `json:"version"`
+	Offset        int64  `json:"offset"`
+	BatchId       string `json:"batch_id,omitempty"`
+	SourceVersion int64  `json:"source_version,omitempty"`
+}
+
+type EventHistoryPage struct {
+	Events     []EventHistoryResponse
+	NextCursor string
 }
 
 func NewEventHistoryResponse(history []model.EventHistory) []EventHistoryResponse {
 	var historyResponse []EventHistoryResponse
 	for _, event := range history {
-		historyResponse = append(historyResponse, EventHistoryResponse{Data{event.Key, event.Value}, event.Action})
+		historyResponse = append(historyResponse, EventHistoryResponse{Data{event.Key, event.Value, event.ValueType}, event.Action, event.Sequence, event.Version, event.Offset, event.BatchId, event.SourceVersion})
 	}
 	return historyResponse
 }
@@ -2,18 +2,27 @@ package eventinfo
 
 import (
 	"context"
+	"errors"
+	"event-history/pkg/diff"
 	"event-history/pkg/eventinfo/dto"
 	"event-history/pkg/eventinfo/model"
 	"event-history/pkg/repository"
 	"fmt"
+	"time"
 )
 
 type Service interface {
 	CreateKey(ctx context.Context, info *model.EventSnapshot) error
 	GetAnswer(ctx context.Context, eventsQuery *dto.EventQuery) (*dto.EventResponse, error)
+	GetAnswerAt(ctx context.Context, eventsQuery *dto.EventQuery, at time.Time) (*dto.EventResponse, error)
 	DeleteKey(ctx context.Context, e *dto.EventQuery) error
 	UpdateKey(ctx context.Context, m *model.EventSnapshot) error
-	GetHistory(ctx context.Context, e *dto.EventQuery) ([]dto.EventHistoryResponse, error)
+	GetHistory(ctx context.Context, h *dto.HistoryQuery) (*dto.EventHistoryPage, error)
+	ApplyBatch(ctx context.Context, operations []dto.BatchOperation) (*dto.BatchResult, error)
+	CompareAndSwap(ctx context.Context, info *model.EventSnapshot, expected model.JSONValue) (*dto.EventResponse, error)
+	RestoreKey(ctx context.Context, eventsQuery *dto.EventQuery) (*dto.EventResponse, error)
+	RevertKey(ctx context.Context, revertQuery *dto.RevertQuery) (*dto.EventResponse, error)
+	Diff(ctx context.Context, diffQuery *dto.DiffQuery) (*dto.DiffResponse, error)
 }
 
 type EventService struct {
@@ -21,6 +30,10 @@ type EventService struct {
 }
 
 func (es *EventService) CreateKey(ctx context.Context, info *model.EventSnapshot) error {
+	if err := setExpiry(info, time.Now()); err != nil {
+		return fmt.Errorf("Service.CreateKey failed. Error: %w", err)
+	}
+
 	err := es.repository.CreateKey(ctx, info)
 	if err != nil {
 		return fmt.Errorf("Service.CreateKey failed. Error: %w", err)
@@ -30,6 +43,10 @@ func (es *EventService) CreateKey(ctx context.Context, info *model.EventSnapshot
 }
 
 func (es *EventService) UpdateKey(ctx context.Context, info *model.EventSnapshot) error {
+	if err := setExpiry(info, time.Now()); err != nil {
+		return fmt.Errorf("Service.UpdateKey failed. Error: %w", err)
+	}
+
 	err := es.repository.UpdateKey(ctx, info)
 	if err != nil {
 		return fmt.Errorf("Service.UpdateKey failed. Error: %w", err)
@@ -47,21 +64,119 @@ func (es *EventService) GetAnswer(ctx context.Context, eventQuery *dto.EventQuer
 	return dto.NewEventResponse(eventInfo), nil
 }
 
+func (es *EventService) GetAnswerAt(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*dto.EventResponse, error) {
+	eventInfo, err := es.repository.GetAnswerAt(ctx, eventQuery, at)
+	if err != nil {
+		return nil, fmt.Errorf("Service.GetAnswerAt: %w", err)
+	}
+
+	return dto.NewEventResponse(eventInfo), nil
+}
+
 func (es *EventService) DeleteKey(ctx context.Context, eventQuery *dto.EventQuery) error {
 	err := es.repository.DeleteKey(ctx, eventQuery)
 	if err != nil {
-		return fmt.Errorf("Service.DeleteKey: %+v", err)
+		return fmt.Errorf("Service.DeleteKey: %w", err)
 	}
 	return nil
 }
 
-func (es *EventService) GetHistory(ctx context.Context, eventQuery *dto.EventQuery) ([]dto.EventHistoryResponse, error) {
-	history, err := es.repository.GetHistory(ctx, eventQuery)
+func (es *EventService) GetHistory(ctx context.Context, historyQuery *dto.HistoryQuery) (*dto.EventHistoryPage, error) {
+	history, nextCursor, err := es.repository.GetHistory(ctx, historyQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Service.GetHistory: %w", err)
+	}
+
+	return &dto.EventHistoryPage{Events: dto.NewEventHistoryResponse(history), NextCursor: nextCursor}, nil
+}
+
+// ApplyBatch writes all operations in one transaction under a new batch id,
+// ErrInvalidBatch is returned without touching the repository when they are malformed.
+func (es *EventService) ApplyBatch(ctx context.Context, operations []dto.BatchOperation) (*dto.BatchResult, error) {
+	if err := validateBatch(operations); err != nil {
+		return nil, fmt.Errorf("Service.ApplyBatch: %w", err)
+	}
+
+	batchId, err := newBatchId()
+	if err != nil {
+		return nil, fmt.Errorf("Service.ApplyBatch: failed to generate batch id: %w", err)
+	}
+
+	history, err := es.repository.ApplyBatch(ctx, batchId, operations)
+	if err != nil {
+		return nil, fmt.Errorf("Service.ApplyBatch: %w", err)
+	}
+
+	return dto.NewBatchResult(batchId, history), nil
+}
+
+// CompareAndSwap returns the key after the swap. When the key does not hold the
+// expected value the error wraps repository.ErrValueMismatch and the response
+// carries the value it holds instead.
+func (es *EventService) CompareAndSwap(ctx context.Context, info *model.EventSnapshot, expected model.JSONValue) (*dto.EventResponse, error) {
+	eventInfo, err := es.repository.CompareAndSwap(ctx, info, expected)
+	if errors.Is(err, repository.ErrValueMismatch) {
+		return dto.NewEventResponse(eventInfo), fmt.Errorf("Service.CompareAndSwap: %w", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("Service.CompareAndSwap: %w", err)
+	}
+
+	return dto.NewEventResponse(eventInfo), nil
+}
+
+// RestoreKey brings back a deleted key with the value it held before the delete.
+func (es *EventService) RestoreKey(ctx context.Context, eventQuery *dto.EventQuery) (*dto.EventResponse, error) {
+	eventInfo, err := es.repository.RestoreKey(ctx, eventQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Service.RestoreKey: %w", err)
+	}
+
+	return dto.NewEventResponse(eventInfo), nil
+}
+
+// RevertKey sets a key back to the value it held at a history sequence number or
+// instant. The change is recorded as a new revert, history is never rewritten.
+func (es *EventService) RevertKey(ctx context.Context, revertQuery *dto.RevertQuery) (*dto.EventResponse, error) {
+	eventInfo, err := es.repository.RevertKey(ctx, revertQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Service.RevertKey: %w", err)
+	}
+
+	return dto.NewEventResponse(eventInfo), nil
+}
+
+// Diff compares the values a key held at two versions. A version that deleted
+// the key holds no value and is reported as repository.ErrVersionNotFound.
+func (es *EventService) Diff(ctx context.Context, diffQuery *dto.DiffQuery) (*dto.DiffResponse, error) {
+	from, err := es.versionValue(ctx, diffQuery.EventQuery, diffQuery.From)
+	if err != nil {
+		return nil, fmt.Errorf("Service.Diff: %w", err)
+	}
+
+	to, err := es.versionValue(ctx, diffQuery.EventQuery, diffQuery.To)
+	if err != nil {
+		return nil, fmt.Errorf("Service.Diff: %w", err)
+	}
+
+	result, err := diff.Diff(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("Service.Diff: %w", err)
+	}
+
+	return &dto.DiffResponse{Key: diffQuery.Key, From: diffQuery.From, To: diffQuery.To, Result: result}, nil
+}
+
+func (es *EventService) versionValue(ctx context.Context, eventQuery dto.EventQuery, version int64) (model.JSONValue, error) {
+	eventQuery.Version = version
+	record, err := es.repository.GetVersion(ctx, &eventQuery)
 	if err != nil {
-		return nil, fmt.Errorf("Service.GetHistory: %+v", err)
+		return "", err
 	}
 
-	return dto.NewEventHistoryResponse(history), nil
+	if record.RemovesKey() {
+		return "", fmt.Errorf("version %d of %s key for %s user holds no value: %w", version, eventQuery.Key, eventQuery.UserId, repository.ErrVersionNotFound)
+	}
+	return record.Value, nil
 }
 
 func NewEventService(repository repository.EventRepository) Service {
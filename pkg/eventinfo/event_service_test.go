@@ -2,26 +2,33 @@ package eventinfo
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"event-history/pkg/diff"
 	"event-history/pkg/eventinfo/dto"
 	"event-history/pkg/eventinfo/model"
+	"event-history/pkg/repository"
 	"event-history/pkg/repository/mock"
+	"fmt"
 	"github.com/smartystreets/assertions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 const userId = "test_user"
 
 func TestGormEventRepository_GetAnswer(t *testing.T) {
 	ctx := context.Background()
-	eventSnapshot := model.EventSnapshot{"name", "john", userId}
+	eventSnapshot := model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 	repositoryMock := mock.EventRepositoryMock{
 		GetAnswerFunc: func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
 			return &eventSnapshot, nil
 		}}
 
 	service := NewEventService(&repositoryMock)
-	event := dto.EventQuery{"name", userId}
+	event := dto.EventQuery{Key: "name", UserId: userId}
 
 	actualSnapshot, err := service.GetAnswer(ctx, &event)
 
@@ -38,7 +45,7 @@ func TestGormEventRepository_GetAnswer_fails(t *testing.T) {
 		}}
 
 	service := NewEventService(&repositoryMock)
-	event := dto.EventQuery{"name", userId}
+	event := dto.EventQuery{Key: "name", UserId: userId}
 
 	actualSnapshot, err := service.GetAnswer(ctx, &event)
 
@@ -46,44 +53,78 @@ func TestGormEventRepository_GetAnswer_fails(t *testing.T) {
 	assertions.ShouldContain(err.Error(), mockError.Error())
 }
 
+func TestGormEventRepository_GetAnswerAt(t *testing.T) {
+	ctx := context.Background()
+	at := time.Date(2021, 3, 1, 14, 3, 0, 0, time.UTC)
+	eventSnapshot := model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
+	repositoryMock := mock.EventRepositoryMock{
+		GetAnswerAtFunc: func(ctx context.Context, eventQuery *dto.EventQuery, asOf time.Time) (*model.EventSnapshot, error) {
+			assert.Equal(t, at, asOf)
+			return &eventSnapshot, nil
+		}}
+
+	service := NewEventService(&repositoryMock)
+
+	actualSnapshot, err := service.GetAnswerAt(ctx, &dto.EventQuery{Key: "name", UserId: userId}, at)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &dto.EventResponse{Key: "name", Value: `"john"`}, actualSnapshot)
+}
+
+func TestGormEventRepository_GetAnswerAt_notFound(t *testing.T) {
+	ctx := context.Background()
+	repositoryMock := mock.EventRepositoryMock{
+		GetAnswerAtFunc: func(ctx context.Context, eventQuery *dto.EventQuery, asOf time.Time) (*model.EventSnapshot, error) {
+			return nil, fmt.Errorf("deleted: %w", repository.ErrKeyNotFound)
+		}}
+
+	service := NewEventService(&repositoryMock)
+
+	actualSnapshot, err := service.GetAnswerAt(ctx, &dto.EventQuery{Key: "name", UserId: userId}, time.Now())
+
+	assert.Nil(t, actualSnapshot)
+	assert.True(t, errors.Is(err, repository.ErrKeyNotFound))
+}
+
 func TestGormEventRepository_GetHistory(t *testing.T) {
 	ctx := context.Background()
 	historyRecords := []model.EventHistory{
-		{Key: "Name", Value: "John", Action: "create"},
-		{Key: "Name", Value: "sam", Action: "update"},
+		{Key: "Name", Value: `"John"`, Action: "create", Version: 1},
+		{Key: "Name", Value: `"sam"`, Action: "update", Version: 2},
 	}
 	repositoryMock := mock.EventRepositoryMock{
-		GetHistoryFunc: func(ctx context.Context, query *dto.EventQuery) ([]model.EventHistory, error) {
-			return historyRecords, nil
+		GetHistoryFunc: func(ctx context.Context, query *dto.HistoryQuery) ([]model.EventHistory, string, error) {
+			return historyRecords, "next", nil
 		}}
 
 	service := NewEventService(&repositoryMock)
-	event := dto.EventQuery{"name", userId}
+	event := dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}, Limit: 2}
 
-	historyResponse, err := service.GetHistory(ctx, &event)
+	historyPage, err := service.GetHistory(ctx, &event)
 
-	assertions.So(err, assertions.ShouldBeNil)
-	assertions.ShouldEqual(len(historyResponse), 2)
-	assertions.ShouldEqual(historyResponse[0], dto.EventHistoryResponse{dto.Data{"Name", "John"}, "create"})
-	assertions.ShouldEqual(historyResponse[1], dto.EventHistoryResponse{dto.Data{"Name", "sam"}, "create"})
+	assert.NoError(t, err)
+	assert.Equal(t, "next", historyPage.NextCursor)
+	assert.Equal(t, []dto.EventHistoryResponse{
+		{Data: dto.Data{Key: "Name", Value: `"John"`}, Event: "create", Version: 1},
+		{Data: dto.Data{Key: "Name", Value: `"sam"`}, Event: "update", Version: 2},
+	}, historyPage.Events)
 }
 
 func TestGormEventRepository_GetHistory_fails(t *testing.T) {
 	ctx := context.Background()
 	mockError := errors.New("failed to get")
 	repositoryMock := mock.EventRepositoryMock{
-		GetHistoryFunc: func(ctx context.Context, query *dto.EventQuery) ([]model.EventHistory, error) {
-			return nil, mockError
+		GetHistoryFunc: func(ctx context.Context, query *dto.HistoryQuery) ([]model.EventHistory, string, error) {
+			return nil, "", mockError
 		}}
 
 	service := NewEventService(&repositoryMock)
-	event := dto.EventQuery{"name", userId}
+	event := dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}}
 
-	historyResponse, err := service.GetHistory(ctx, &event)
+	historyPage, err := service.GetHistory(ctx, &event)
 
-	assertions.ShouldEqual(len(historyResponse), 0)
-	assertions.So(err, assertions.ShouldBeNil)
-	assertions.ShouldContain(err.Error(), mockError.Error())
+	assert.Nil(t, historyPage)
+	assert.True(t, errors.Is(err, mockError))
 }
 
 func TestGormEventRepository_DeleteKey(t *testing.T) {
@@ -94,7 +135,7 @@ func TestGormEventRepository_DeleteKey(t *testing.T) {
 		},
 	}
 	service := NewEventService(&repositoryMock)
-	event := dto.EventQuery{"name", userId}
+	event := dto.EventQuery{Key: "name", UserId: userId}
 
 	err := service.DeleteKey(ctx, &event)
 
@@ -110,7 +151,7 @@ func TestGormEventRepository_DeleteKey_fails(t *testing.T) {
 		},
 	}
 	service := NewEventService(&repositoryMock)
-	event := dto.EventQuery{"name", userId}
+	event := dto.EventQuery{Key: "name", UserId: userId}
 
 	err := service.DeleteKey(ctx, &event)
 
@@ -126,7 +167,7 @@ func TestGormEventRepository_UpdateKey(t *testing.T) {
 	}
 
 	service := NewEventService(&repositoryMock)
-	updateEvent := model.EventSnapshot{"name", "john", userId}
+	updateEvent := model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 
 	err := service.UpdateKey(ctx, &updateEvent)
 
@@ -135,7 +176,7 @@ func TestGormEventRepository_UpdateKey(t *testing.T) {
 
 func TestGormEventRepository_UpdateKey_fails(t *testing.T) {
 	ctx := context.Background()
-	updateEvent := model.EventSnapshot{"name", "john", userId}
+	updateEvent := model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 	mockError := errors.New("failed to update")
 	repositoryMock := mock.EventRepositoryMock{
 		UpdateKeyFunc: func(ctx context.Context, event *model.EventSnapshot) error {
@@ -162,7 +203,7 @@ func TestGormEventRepository_CreateKey(t *testing.T) {
 	}
 
 	service := NewEventService(&repositoryMock)
-	updateEvent := model.EventSnapshot{"name", "john", userId}
+	updateEvent := model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 
 	err := service.CreateKey(ctx, &updateEvent)
 
@@ -171,7 +212,7 @@ func TestGormEventRepository_CreateKey(t *testing.T) {
 
 func TestGormEventRepository_CreateKey_fails(t *testing.T) {
 	ctx := context.Background()
-	createEvent := model.EventSnapshot{"name", "john", userId}
+	createEvent := model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 	mockError := errors.New("failed to update")
 	repositoryMock := mock.EventRepositoryMock{
 		CreateKeyFunc: func(ctx context.Context, event *model.EventSnapshot) error {
@@ -188,3 +229,157 @@ func TestGormEventRepository_CreateKey_fails(t *testing.T) {
 
 	assertions.ShouldContain(err.Error(), mockError.Error())
 }
+
+func TestEventService_ApplyBatch(t *testing.T) {
+	ctx := context.Background()
+	operations := []dto.BatchOperation{
+		{Action: model.CreateAction, Key: "name", Value: `"john"`, UserId: userId},
+		{Action: model.DeleteAction, Key: "city", UserId: userId},
+	}
+	var appliedBatchId string
+	repositoryMock := mock.EventRepositoryMock{
+		ApplyBatchFunc: func(ctx context.Context, batchId string, ops []dto.BatchOperation) ([]model.EventHistory, error) {
+			appliedBatchId = batchId
+			return []model.EventHistory{
+				{Key: "name", Value: `"john"`, UserId: userId, Action: model.CreateAction, Version: 1, Sequence: 1, BatchId: batchId},
+				{Key: "city", UserId: userId, Action: model.DeleteAction, Version: 3, Sequence: 3, BatchId: batchId},
+			}, nil
+		}}
+
+	service := NewEventService(&repositoryMock)
+
+	result, err := service.ApplyBatch(ctx, operations)
+
+	require.NoError(t, err)
+	assert.Len(t, appliedBatchId, 36)
+	assert.Equal(t, &dto.BatchResult{BatchId: appliedBatchId, Events: []dto.BatchEventResponse{
+		{Key: "name", UserId: userId, Event: model.CreateAction, Version: 1, Sequence: 1},
+		{Key: "city", UserId: userId, Event: model.DeleteAction, Version: 3, Sequence: 3},
+	}}, result)
+}
+
+func TestEventService_ApplyBatch_invalid(t *testing.T) {
+	ctx := context.Background()
+	tooMany := make([]dto.BatchOperation, dto.MaxBatchOperations+1)
+	for i := range tooMany {
+		tooMany[i] = dto.BatchOperation{Action: model.CreateAction, Key: fmt.Sprintf("key%d", i), UserId: userId}
+	}
+	repositoryMock := mock.EventRepositoryMock{}
+	service := NewEventService(&repositoryMock)
+
+	for name, operations := range map[string][]dto.BatchOperation{
+		"empty":          nil,
+		"too many":       tooMany,
+		"unknown action": {{Action: "upsert", Key: "name", UserId: userId}},
+		"missing key":    {{Action: model.CreateAction, UserId: userId}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := service.ApplyBatch(ctx, operations)
+
+			assert.Nil(t, result)
+			assert.True(t, errors.Is(err, ErrInvalidBatch))
+		})
+	}
+	assert.Empty(t, repositoryMock.ApplyBatchCalls())
+}
+
+func TestEventService_CompareAndSwap_mismatch(t *testing.T) {
+	ctx := context.Background()
+	repositoryMock := mock.EventRepositoryMock{
+		CompareAndSwapFunc: func(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error) {
+			assert.Equal(t, model.JSONValue(`"open"`), expected)
+			return &model.EventSnapshot{Key: "state", Value: `"closed"`, UserId: userId, Version: 4}, fmt.Errorf("changed: %w", repository.ErrValueMismatch)
+		}}
+
+	service := NewEventService(&repositoryMock)
+
+	current, err := service.CompareAndSwap(ctx, &model.EventSnapshot{Key: "state", Value: `"done"`, UserId: userId}, `"open"`)
+
+	assert.True(t, errors.Is(err, repository.ErrValueMismatch))
+	assert.Equal(t, &dto.EventResponse{Key: "state", Value: `"closed"`, Version: 4}, current)
+}
+
+func TestEventService_RestoreKey(t *testing.T) {
+	ctx := context.Background()
+	repositoryMock := mock.EventRepositoryMock{
+		RestoreKeyFunc: func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+			return &model.EventSnapshot{Key: "name", Value: `"john"`, ValueType: model.StringValue, UserId: userId, Version: 3}, nil
+		}}
+
+	service := NewEventService(&repositoryMock)
+
+	restored, err := service.RestoreKey(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+
+	require.NoError(t, err)
+	assert.Equal(t, &dto.EventResponse{Key: "name", Value: `"john"`, ValueType: model.StringValue, Version: 3}, restored)
+}
+
+func TestEventService_RevertKey(t *testing.T) {
+	ctx := context.Background()
+	repositoryMock := mock.EventRepositoryMock{
+		RevertKeyFunc: func(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error) {
+			assert.Equal(t, int64(2), revertQuery.Sequence)
+			return nil, fmt.Errorf("sequence 2: %w", repository.ErrVersionNotFound)
+		}}
+
+	service := NewEventService(&repositoryMock)
+
+	_, err := service.RevertKey(ctx, &dto.RevertQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}, Sequence: 2})
+
+	assert.True(t, errors.Is(err, repository.ErrVersionNotFound))
+}
+
+func TestEventService_Diff(t *testing.T) {
+	ctx := context.Background()
+	values := map[int64]model.EventHistory{
+		1: {Key: "profile", Value: `{"name":"john","age":30}`, UserId: userId, Action: model.CreateAction, Version: 1},
+		2: {Key: "profile", Value: `{"name":"john","age":31}`, UserId: userId, Action: model.UpdateAction, Version: 2},
+		3: {Key: "profile", UserId: userId, Action: model.DeleteAction, Version: 3},
+	}
+	repositoryMock := mock.EventRepositoryMock{
+		GetVersionFunc: func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error) {
+			record := values[eventQuery.Version]
+			return &record, nil
+		}}
+
+	service := NewEventService(&repositoryMock)
+
+	diffResponse, err := service.Diff(ctx, &dto.DiffQuery{EventQuery: dto.EventQuery{Key: "profile", UserId: userId}, From: 1, To: 2})
+
+	require.NoError(t, err)
+	assert.Equal(t, diff.JSONPatchFormat, diffResponse.Format)
+	assert.Equal(t, []diff.Operation{{Op: diff.ReplaceOperation, Path: "/age", Value: json.RawMessage(`31`)}}, diffResponse.Patch)
+
+	_, err = service.Diff(ctx, &dto.DiffQuery{EventQuery: dto.EventQuery{Key: "profile", UserId: userId}, From: 2, To: 3})
+
+	assert.True(t, errors.Is(err, repository.ErrVersionNotFound))
+}
+
+func TestEventService_CreateKey_ttl(t *testing.T) {
+	ctx := context.Background()
+	repositoryMock := mock.EventRepositoryMock{
+		CreateKeyFunc: func(ctx context.Context, info *model.EventSnapshot) error {
+			return nil
+		}}
+
+	service := NewEventService(&repositoryMock)
+	info := &model.EventSnapshot{Key: "session", Value: `"abc"`, UserId: userId, TTL: 60}
+
+	err := service.CreateKey(ctx, info)
+
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *info.ExpiresAt, time.Second)
+	assert.Equal(t, time.UTC, info.ExpiresAt.Location())
+
+	past := time.Now().Add(-time.Minute)
+	for _, invalid := range []*model.EventSnapshot{
+		{Key: "session", Value: `"abc"`, UserId: userId, TTL: -1},
+		{Key: "session", Value: `"abc"`, UserId: userId, TTL: 60, ExpiresAt: info.ExpiresAt},
+		{Key: "session", Value: `"abc"`, UserId: userId, ExpiresAt: &past},
+	} {
+		err = service.CreateKey(ctx, invalid)
+
+		assert.True(t, errors.Is(err, ErrInvalidExpiry))
+	}
+	assert.Equal(t, 1, len(repositoryMock.CreateKeyCalls()))
+}
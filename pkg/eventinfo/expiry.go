@@ -0,0 +1,32 @@
+package eventinfo
+
+import (
+	"errors"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidExpiry = errors.New("invalid expiry")
+
+// setExpiry turns the ttl of a write into an expiry time. Expiry times are kept
+// in UTC, a write without ttl or expires_at leaves the expiry of the key as is.
+func setExpiry(info *model.EventSnapshot, now time.Time) error {
+	switch {
+	case info.TTL < 0:
+		return fmt.Errorf("ttl must be a positive number of seconds: %w", ErrInvalidExpiry)
+	case info.TTL > 0 && info.ExpiresAt != nil:
+		return fmt.Errorf("only one of ttl and expires_at can be set: %w", ErrInvalidExpiry)
+	case info.TTL > 0:
+		expiresAt := now.Add(time.Duration(info.TTL) * time.Second).UTC()
+		info.ExpiresAt = &expiresAt
+	case info.ExpiresAt != nil:
+		if !info.ExpiresAt.After(now) {
+			return fmt.Errorf("expires_at must be in the future: %w", ErrInvalidExpiry)
+		}
+		expiresAt := info.ExpiresAt.UTC()
+		info.ExpiresAt = &expiresAt
+	}
+
+	return nil
+}
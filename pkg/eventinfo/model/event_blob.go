@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// EventBlob holds a large value once, snapshots and history records refer to
+// it by Hash, the hex encoded sha256 of the value.
+type EventBlob struct {
+	Hash      string    `gorm:"column:hash;primaryKey"`
+	Value     JSONValue `gorm:"column:value"`
+	Size      int64     `gorm:"column:size"`
+	CreatedAt time.Time `gorm:"column:created_at;default:now()"`
+}
+
+func (EventBlob) TableName() string {
+	return "event_blob"
+}
@@ -5,23 +5,47 @@ import (
 )
 
 const (
-	CreateAction = "create"
-	UpdateAction = "update"
-	DeleteAction = "delete"
+	CreateAction  = "create"
+	UpdateAction  = "update"
+	DeleteAction  = "delete"
+	RestoreAction = "restore"
+	RevertAction  = "revert"
+	ExpireAction  = "expire"
 )
 
+// RemovingActions are the actions that leave a key without a snapshot.
+var RemovingActions = []string{DeleteAction, ExpireAction}
+
 type EventHistory struct {
-	Key       string    `gorm:"column:key;" json:"key"`
-	Value     string    `gorm:"column:value;" json:"value"`
-	UserId    string    `gorm:"column:user_id" json:"user_id"`
-	Action    string    `gorm:"column:action" json:"action"`
-	CreatedAt time.Time `gorm:"column:created_at;default:now()" json:"created_at"`
+	Key           string     `gorm:"column:key;" json:"key"`
+	Value         JSONValue  `gorm:"column:value;" json:"value"`
+	ValueType     string     `gorm:"column:value_type;default:null" json:"value_type,omitempty"`
+	UserId        string     `gorm:"column:user_id" json:"user_id"`
+	Action        string     `gorm:"column:action" json:"action"`
+	Version       int64      `gorm:"column:version" json:"version"`
+	Sequence      int64      `gorm:"column:sequence" json:"sequence"`
+	Offset        int64      `gorm:"column:event_offset;->" json:"offset"`
+	BatchId       string     `gorm:"column:batch_id;default:null" json:"batch_id,omitempty"`
+	BlobHash      string     `gorm:"column:blob_hash;default:null" json:"blob_hash,omitempty"`
+	SourceVersion int64      `gorm:"column:source_version;default:null" json:"source_version,omitempty"`
+	ExpiresAt     *time.Time `gorm:"column:expires_at" json:"expires_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;default:now()" json:"created_at"`
 }
 
 func (EventHistory) TableName() string {
 	return "event_history"
 }
 
+// RemovesKey reports whether the record leaves the key without a snapshot.
+func (eh EventHistory) RemovesKey() bool {
+	for _, action := range RemovingActions {
+		if eh.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
 func NewHistoryRecord(info *EventSnapshot, action string) *EventHistory {
-	return &EventHistory{Key: info.Key, Value: info.Value, UserId: info.UserId, Action: action}
+	return &EventHistory{Key: info.Key, Value: info.Value, ValueType: info.ValueType, UserId: info.UserId, Action: action, Version: info.Version, BlobHash: info.BlobHash, ExpiresAt: info.ExpiresAt}
 }
@@ -1,11 +1,24 @@
 package model
 
+import "time"
+
 type EventSnapshot struct {
-	Key     string    `gorm:"column:key;" json:"key"`
-	Value     string    `gorm:"column:value;" json:"value"`
-	UserId    string    `gorm:"column:user_id" json:"user_id"`
+	Key       string     `gorm:"column:key;" json:"key"`
+	Value     JSONValue  `gorm:"column:value;" json:"value"`
+	ValueType string     `gorm:"column:value_type" json:"value_type,omitempty"`
+	UserId    string     `gorm:"column:user_id" json:"user_id"`
+	Version   int64      `gorm:"column:version" json:"version"`
+	BlobHash  string     `gorm:"column:blob_hash;default:null" json:"blob_hash,omitempty"`
+	ExpiresAt *time.Time `gorm:"column:expires_at" json:"expires_at,omitempty"`
+	// TTL is how many seconds a write keeps the key for, it is turned into ExpiresAt.
+	TTL int64 `gorm:"-" json:"ttl,omitempty"`
 }
 
 func (EventSnapshot) TableName() string {
 	return "event_snapshot"
 }
+
+// ExpiredAt reports whether the key has expired by the given instant.
+func (es EventSnapshot) ExpiredAt(now time.Time) bool {
+	return es.ExpiresAt != nil && !es.ExpiresAt.After(now)
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+const (
+	StringValue  = "string"
+	NumberValue  = "number"
+	BooleanValue = "boolean"
+	ObjectValue  = "object"
+	ArrayValue   = "array"
+	NullValue    = "null"
+)
+
+// JSONValue holds the raw JSON of a value. It is (un)marshalled as is, so API
+// clients send and receive native JSON, and is stored as jsonb, json or text
+// depending on the database. The empty JSONValue is stored as NULL, history
+// records of deletes carry no value.
+type JSONValue string
+
+func (v JSONValue) MarshalJSON() ([]byte, error) {
+	if v == "" {
+		return []byte("null"), nil
+	}
+	return []byte(v), nil
+}
+
+// UnmarshalJSON keeps the compacted raw JSON, the decoder has already made sure
+// that it is valid.
+func (v *JSONValue) UnmarshalJSON(data []byte) error {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		return err
+	}
+
+	*v = JSONValue(compacted.String())
+	return nil
+}
+
+func (v JSONValue) Value() (driver.Value, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	if !json.Valid([]byte(v)) {
+		return nil, fmt.Errorf("value is not valid JSON: %.50s", string(v))
+	}
+	return string(v), nil
+}
+
+func (v *JSONValue) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*v = ""
+	case string:
+		*v = JSONValue(src)
+	case []byte:
+		*v = JSONValue(src)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONValue", src)
+	}
+	return nil
+}
+
+// Type names the kind of JSON value, it is empty for the empty JSONValue.
+func (v JSONValue) Type() string {
+	trimmed := bytes.TrimSpace([]byte(v))
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	switch trimmed[0] {
+	case '{':
+		return ObjectValue
+	case '[':
+		return ArrayValue
+	case '"':
+		return StringValue
+	case 't', 'f':
+		return BooleanValue
+	case 'n':
+		return NullValue
+	default:
+		return NumberValue
+	}
+}
+
+// Equal compares the JSON both values hold, regardless of how the database
+// formatted it. Object keys are unordered and numbers compare by value.
+func (v JSONValue) Equal(other JSONValue) bool {
+	if v == other {
+		return true
+	}
+
+	var left, right interface{}
+	if json.Unmarshal([]byte(v), &left) != nil || json.Unmarshal([]byte(other), &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestJSONValue_Type(t *testing.T) {
+	testCases := map[JSONValue]string{
+		`"john"`:          StringValue,
+		`42.5`:            NumberValue,
+		`-1`:              NumberValue,
+		`true`:            BooleanValue,
+		`false`:           BooleanValue,
+		`null`:            NullValue,
+		`{"name":"john"}`: ObjectValue,
+		`[1,2]`:           ArrayValue,
+		``:                "",
+	}
+
+	for value, expectedType := range testCases {
+		assert.Equal(t, expectedType, value.Type(), string(value))
+	}
+}
+
+func TestJSONValue_Equal(t *testing.T) {
+	assert.True(t, JSONValue(`{"a":1,"b":[true]}`).Equal(`{"b": [true], "a": 1.0}`))
+	assert.False(t, JSONValue(`{"a":1}`).Equal(`{"a":"1"}`))
+	assert.False(t, JSONValue(`"open"`).Equal(`open`))
+}
+
+func TestJSONValue_json(t *testing.T) {
+	var snapshot EventSnapshot
+	err := json.Unmarshal([]byte(`{"key": "profile", "value": {"name": "john", "tags": [ "a" ]}}`), &snapshot)
+
+	require.NoError(t, err)
+	assert.Equal(t, JSONValue(`{"name":"john","tags":["a"]}`), snapshot.Value)
+
+	encoded, err := json.Marshal(EventHistory{Key: "profile", Action: DeleteAction})
+
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"value":null`)
+}
+
+func TestJSONValue_Value(t *testing.T) {
+	stored, err := JSONValue(`[1]`).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `[1]`, stored)
+
+	stored, err = JSONValue("").Value()
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+
+	_, err = JSONValue("john").Value()
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package eventinfo
+
+import (
+	"context"
+	"event-history/pkg/repository"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reaper deletes expired keys in the background, recording an expire in the
+// history of each of them.
+type Reaper interface {
+	Run(ctx context.Context)
+}
+
+type keyReaper struct {
+	repository repository.EventRepository
+	lgr        *zap.Logger
+	interval   time.Duration
+	batchSize  int
+}
+
+// Run reaps every interval until ctx is done.
+func (kr *keyReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(kr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			kr.reap(ctx)
+		}
+	}
+}
+
+// reap expires keys batch by batch until none is left and returns how many it expired.
+func (kr *keyReaper) reap(ctx context.Context) int {
+	reaped := 0
+	for ctx.Err() == nil {
+		expired, err := kr.repository.ExpireKeys(ctx, time.Now(), kr.batchSize)
+		if err != nil {
+			kr.lgr.Error("failed to expire keys", zap.Error(err))
+			break
+		}
+
+		reaped += len(expired)
+		if len(expired) == 0 || len(expired) < kr.batchSize {
+			break
+		}
+	}
+
+	if reaped > 0 {
+		kr.lgr.Info("expired keys", zap.Int("keys", reaped))
+	}
+	return reaped
+}
+
+func NewReaper(repository repository.EventRepository, lgr *zap.Logger, interval time.Duration, batchSize int) Reaper {
+	return &keyReaper{
+		repository: repository,
+		lgr:        lgr,
+		interval:   interval,
+		batchSize:  batchSize,
+	}
+}
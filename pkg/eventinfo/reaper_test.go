@@ -0,0 +1,46 @@
+package eventinfo
+
+import (
+	"context"
+	"event-history/pkg/eventinfo/model"
+	"event-history/pkg/repository/mock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestKeyReaper_reap(t *testing.T) {
+	batches := [][]model.EventHistory{
+		{{Key: "a", Action: model.ExpireAction}, {Key: "b", Action: model.ExpireAction}},
+		{{Key: "c", Action: model.ExpireAction}},
+	}
+	repositoryMock := mock.EventRepositoryMock{
+		ExpireKeysFunc: func(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error) {
+			assert.Equal(t, 2, limit)
+			batch := batches[0]
+			batches = batches[1:]
+			return batch, nil
+		}}
+
+	reaper := &keyReaper{repository: &repositoryMock, lgr: zap.NewNop(), interval: time.Minute, batchSize: 2}
+
+	assert.Equal(t, 3, reaper.reap(context.Background()))
+	assert.Equal(t, 2, len(repositoryMock.ExpireKeysCalls()))
+}
+
+func TestKeyReaper_reap_unlimitedBatch(t *testing.T) {
+	batches := [][]model.EventHistory{{{Key: "a", Action: model.ExpireAction}}, {}}
+	repositoryMock := mock.EventRepositoryMock{
+		ExpireKeysFunc: func(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error) {
+			batch := batches[0]
+			batches = batches[1:]
+			return batch, nil
+		}}
+
+	reaper := &keyReaper{repository: &repositoryMock, lgr: zap.NewNop(), interval: time.Minute, batchSize: 0}
+
+	assert.Equal(t, 1, reaper.reap(context.Background()))
+	assert.Equal(t, 2, len(repositoryMock.ExpireKeysCalls()), "stops once nothing is left to expire")
+}
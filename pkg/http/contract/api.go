@@ -1,9 +1,10 @@
 package contract
 
 type APIResponse struct {
-	Data    interface{} `json:"data,omitempty"`
-	Error   *Error      `json:"error,omitempty"`
-	Success bool        `json:"success"`
+	Data       interface{} `json:"data,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Error      *Error      `json:"error,omitempty"`
+	Success    bool        `json:"success"`
 }
 
 type Error struct {
@@ -17,9 +18,22 @@ func NewSuccessResponse(data interface{}) APIResponse {
 	}
 }
 
+func NewPaginatedSuccessResponse(data interface{}, nextCursor string) APIResponse {
+	return APIResponse{
+		Success:    true,
+		Data:       data,
+		NextCursor: nextCursor,
+	}
+}
+
 func NewFailureResponse(description string) APIResponse {
+	return NewFailureResponseWithData(description, nil)
+}
+
+func NewFailureResponseWithData(description string, data interface{}) APIResponse {
 	return APIResponse{
 		Success: false,
+		Data:    data,
 		Error: &Error{
 			Description: description,
 		},
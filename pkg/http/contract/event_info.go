@@ -10,8 +10,13 @@ type EventFormatter struct {
 }
 
 func (sf *EventFormatter) FormatEventInfoResponse() interface{} {
-	return map[string]interface{}{
-		"Key":   sf.EventResponses.Key,
-		"Value": sf.EventResponses.Value,
+	response := map[string]interface{}{
+		"Key":       sf.EventResponses.Key,
+		"Value":     sf.EventResponses.Value,
+		"ValueType": sf.EventResponses.ValueType,
 	}
+	if sf.EventResponses.ExpiresAt != nil {
+		response["ExpiresAt"] = sf.EventResponses.ExpiresAt
+	}
+	return response
 }
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"event-history/pkg/http/internal/resperr"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	eTagHeader    = "ETag"
+	ifMatchHeader = "If-Match"
+)
+
+func formatETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch returns the version a write is conditional on. Zero means the
+// header was absent or "*", in which case the write is unconditional.
+func parseIfMatch(req *http.Request) (int64, error) {
+	ifMatch := strings.TrimSpace(req.Header.Get(ifMatchHeader))
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+	if err != nil || version < 1 {
+		return 0, resperr.NewResponseError(http.StatusBadRequest, fmt.Sprintf("header '%s' must be a single version ETag", ifMatchHeader))
+	}
+
+	return version, nil
+}
+
+// versionMismatchError answers 412 when the If-Match precondition failed and 409
+// when the version sent in the request body is stale.
+func versionMismatchError(fromIfMatch bool, key, userId string) error {
+	if fromIfMatch {
+		return resperr.NewResponseError(http.StatusPreconditionFailed, fmt.Sprintf("key %s for user %s does not match %s", key, userId, ifMatchHeader))
+	}
+
+	return resperr.NewResponseError(http.StatusConflict, fmt.Sprintf("key %s for user %s was modified concurrently", key, userId))
+}
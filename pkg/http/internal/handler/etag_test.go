@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	testCases := map[string]struct {
+		header          string
+		expectedVersion int64
+		expectedErr     bool
+	}{
+		"absent header":      {header: "", expectedVersion: 0},
+		"wildcard":           {header: "*", expectedVersion: 0},
+		"strong etag":        {header: `"3"`, expectedVersion: 3},
+		"weak etag":          {header: `W/"4"`, expectedVersion: 4},
+		"not a version":      {header: `"abc"`, expectedErr: true},
+		"list of etags":      {header: `"1", "2"`, expectedErr: true},
+		"non positive value": {header: `"0"`, expectedErr: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/", nil)
+			if testCase.header != "" {
+				req.Header.Set(ifMatchHeader, testCase.header)
+			}
+
+			version, err := parseIfMatch(req)
+
+			assert.Equal(t, testCase.expectedVersion, version)
+			assert.Equal(t, testCase.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestFormatETag(t *testing.T) {
+	assert.Equal(t, `"12"`, formatETag(12))
+}
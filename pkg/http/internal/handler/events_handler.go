@@ -2,14 +2,19 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"event-history/pkg/eventinfo"
 	"event-history/pkg/eventinfo/dto"
 	"event-history/pkg/eventinfo/model"
 	"event-history/pkg/http/contract"
+	"event-history/pkg/http/internal/resperr"
 	"event-history/pkg/http/internal/utils"
+	"event-history/pkg/repository"
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -27,7 +32,7 @@ func NewEventsHandler(lgr *zap.Logger, svc eventinfo.Service) *EventsHandler {
 }
 
 func (sih *EventsHandler) Create(resp http.ResponseWriter, req *http.Request) error {
-	ctx := context.Background()
+	ctx := req.Context()
 	var eventInfo model.EventSnapshot
 	err := utils.ParseRequest(req, &eventInfo)
 	if err != nil {
@@ -35,7 +40,9 @@ func (sih *EventsHandler) Create(resp http.ResponseWriter, req *http.Request) er
 	}
 
 	err = sih.svc.CreateKey(ctx, &eventInfo)
-	if err != nil {
+	if errors.Is(err, eventinfo.ErrInvalidExpiry) {
+		return resperr.NewResponseError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
 		return fmt.Errorf("EventsHandler.CreateKey . error %v", err)
 	}
 
@@ -45,25 +52,38 @@ func (sih *EventsHandler) Create(resp http.ResponseWriter, req *http.Request) er
 }
 
 func (sih *EventsHandler) Update(resp http.ResponseWriter, req *http.Request) error {
-	ctx := context.Background()
+	ctx := req.Context()
 	var eventInfo model.EventSnapshot
 	err := utils.ParseRequest(req, &eventInfo)
 	if err != nil {
 		return err
 	}
 
-	err = sih.svc.UpdateKey(ctx, &eventInfo)
+	ifMatch, err := parseIfMatch(req)
 	if err != nil {
+		return err
+	}
+	if ifMatch != 0 {
+		eventInfo.Version = ifMatch
+	}
+
+	err = sih.svc.UpdateKey(ctx, &eventInfo)
+	if errors.Is(err, eventinfo.ErrInvalidExpiry) {
+		return resperr.NewResponseError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, repository.ErrVersionMismatch) {
+		return versionMismatchError(ifMatch != 0, eventInfo.Key, eventInfo.UserId)
+	} else if err != nil {
 		return fmt.Errorf("EventsHandler.UpdateKey . error %v", err)
 	}
 
 	sih.lgr.Debug("msg", zap.String("eventCode", contract.EventInfoUpdateSuccess))
+	resp.Header().Set(eTagHeader, formatETag(eventInfo.Version))
 	utils.WriteSuccessResponse(resp, http.StatusCreated, contract.EventInfoUpdateSuccess)
 	return nil
 }
 
 func (sih *EventsHandler) Delete(resp http.ResponseWriter, req *http.Request) error {
-	ctx := context.Background()
+	ctx := req.Context()
 	key, ok := mux.Vars(req)["key"]
 	if !ok || len(key) < 1 {
 		return fmt.Errorf("URL query Param 'key' is missing")
@@ -74,8 +94,15 @@ func (sih *EventsHandler) Delete(resp http.ResponseWriter, req *http.Request) er
 		return fmt.Errorf("URL query Param 'userId' is missing")
 	}
 
-	err := sih.svc.DeleteKey(ctx, &dto.EventQuery{key, userId})
+	ifMatch, err := parseIfMatch(req)
 	if err != nil {
+		return err
+	}
+
+	err = sih.svc.DeleteKey(ctx, &dto.EventQuery{Key: key, UserId: userId, Version: ifMatch})
+	if errors.Is(err, repository.ErrVersionMismatch) {
+		return versionMismatchError(ifMatch != 0, key, userId)
+	} else if err != nil {
 		return fmt.Errorf("error occurred while fetching key details Infos: %v", err)
 	}
 	utils.WriteSuccessResponse(resp, http.StatusOK, nil)
@@ -83,7 +110,7 @@ func (sih *EventsHandler) Delete(resp http.ResponseWriter, req *http.Request) er
 }
 
 func (sih *EventsHandler) Get(resp http.ResponseWriter, req *http.Request) error {
-	ctx := context.Background()
+	ctx := req.Context()
 	key, ok := mux.Vars(req)["key"]
 	if !ok || len(key) < 1 {
 		return fmt.Errorf("URL query Param 'key' is missing")
@@ -94,17 +121,39 @@ func (sih *EventsHandler) Get(resp http.ResponseWriter, req *http.Request) error
 		return fmt.Errorf("URL query Param 'userId' is missing")
 	}
 
-	eventResponse, err := sih.svc.GetAnswer(ctx, &dto.EventQuery{key, userId})
+	if asOf := req.URL.Query().Get("as_of"); asOf != "" {
+		return sih.getAt(ctx, resp, &dto.EventQuery{Key: key, UserId: userId}, asOf)
+	}
+
+	eventResponse, err := sih.svc.GetAnswer(ctx, &dto.EventQuery{Key: key, UserId: userId})
 	if err != nil {
 		return fmt.Errorf("error occurred while fetching key details Infos: %v", err)
 	}
-	sf := &contract.EventFormatter{eventResponse}
+	resp.Header().Set(eTagHeader, formatETag(eventResponse.Version))
+	sf := &contract.EventFormatter{EventResponses: eventResponse}
+	utils.WriteSuccessResponse(resp, http.StatusOK, sf.FormatEventInfoResponse())
+	return nil
+}
+
+func (sih *EventsHandler) getAt(ctx context.Context, resp http.ResponseWriter, eventQuery *dto.EventQuery, asOf string) error {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return resperr.NewResponseError(http.StatusBadRequest, "URL query Param 'as_of' must be an RFC3339 timestamp")
+	}
+
+	eventResponse, err := sih.svc.GetAnswerAt(ctx, eventQuery, at)
+	if errors.Is(err, repository.ErrKeyNotFound) {
+		return resperr.NewResponseError(http.StatusNotFound, fmt.Sprintf("key %s not found for user %s at %s", eventQuery.Key, eventQuery.UserId, asOf))
+	} else if err != nil {
+		return fmt.Errorf("error occurred while fetching key details Infos: %v", err)
+	}
+	sf := &contract.EventFormatter{EventResponses: eventResponse}
 	utils.WriteSuccessResponse(resp, http.StatusOK, sf.FormatEventInfoResponse())
 	return nil
 }
 
 func (sih *EventsHandler) GetHistory(resp http.ResponseWriter, req *http.Request) error {
-	ctx := context.Background()
+	ctx := req.Context()
 	key, ok := mux.Vars(req)["key"]
 	if !ok || len(key) < 1 {
 		return fmt.Errorf("URL query Param 'key' is missing")
@@ -115,10 +164,218 @@ func (sih *EventsHandler) GetHistory(resp http.ResponseWriter, req *http.Request
 		return fmt.Errorf("URL query Param 'userId' is missing")
 	}
 
-	historyResponse, err := sih.svc.GetHistory(ctx, &dto.EventQuery{key, userId})
+	historyQuery, err := parseHistoryQuery(req, dto.EventQuery{Key: key, UserId: userId})
 	if err != nil {
+		return err
+	}
+
+	historyPage, err := sih.svc.GetHistory(ctx, historyQuery)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return resperr.NewResponseError(http.StatusBadRequest, "URL query Param 'cursor' is invalid")
+	} else if err != nil {
 		return fmt.Errorf("error occurred while fetching key details Infos: %v", err)
 	}
-	utils.WriteSuccessResponse(resp, http.StatusOK, historyResponse)
+	utils.WritePaginatedSuccessResponse(resp, http.StatusOK, historyPage.Events, historyPage.NextCursor)
+	return nil
+}
+
+// Batch applies a list of create, update and delete operations all or nothing.
+func (sih *EventsHandler) Batch(resp http.ResponseWriter, req *http.Request) error {
+	ctx := req.Context()
+	var batchRequest dto.BatchRequest
+	err := utils.ParseRequest(req, &batchRequest)
+	if err != nil {
+		return err
+	}
+
+	batchResult, err := sih.svc.ApplyBatch(ctx, batchRequest.Operations)
+	switch {
+	case errors.Is(err, eventinfo.ErrInvalidBatch):
+		return resperr.NewResponseError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return resperr.NewResponseError(http.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrKeyNotFound):
+		return resperr.NewResponseError(http.StatusNotFound, err.Error())
+	case err != nil:
+		return fmt.Errorf("EventsHandler.Batch . error %v", err)
+	}
+
+	sih.lgr.Debug("msg", zap.String("batchId", batchResult.BatchId), zap.Int("operations", len(batchResult.Events)))
+	utils.WriteSuccessResponse(resp, http.StatusOK, batchResult)
 	return nil
 }
+
+// CompareAndSwap sets the value of a key only if it holds the expected one,
+// otherwise it answers 409 with the value the key holds.
+func (sih *EventsHandler) CompareAndSwap(resp http.ResponseWriter, req *http.Request) error {
+	ctx := req.Context()
+	key, ok := mux.Vars(req)["key"]
+	if !ok || len(key) < 1 {
+		return fmt.Errorf("URL query Param 'key' is missing")
+	}
+
+	userId, ok := mux.Vars(req)["user_id"]
+	if !ok || len(userId) < 1 {
+		return fmt.Errorf("URL query Param 'userId' is missing")
+	}
+
+	var casRequest dto.CompareAndSwapRequest
+	err := utils.ParseRequest(req, &casRequest)
+	if err != nil {
+		return err
+	}
+
+	eventInfo := &model.EventSnapshot{Key: key, Value: casRequest.Value, UserId: userId}
+	eventResponse, err := sih.svc.CompareAndSwap(ctx, eventInfo, casRequest.Expected)
+	switch {
+	case errors.Is(err, repository.ErrValueMismatch):
+		sf := &contract.EventFormatter{EventResponses: eventResponse}
+		resp.Header().Set(eTagHeader, formatETag(eventResponse.Version))
+		return resperr.NewResponseErrorWithData(http.StatusConflict, fmt.Sprintf("key %s of user %s does not hold the expected value", key, userId), sf.FormatEventInfoResponse())
+	case errors.Is(err, repository.ErrKeyNotFound):
+		return resperr.NewResponseError(http.StatusNotFound, fmt.Sprintf("key %s not found for user %s", key, userId))
+	case err != nil:
+		return fmt.Errorf("EventsHandler.CompareAndSwap . error %v", err)
+	}
+
+	resp.Header().Set(eTagHeader, formatETag(eventResponse.Version))
+	sf := &contract.EventFormatter{EventResponses: eventResponse}
+	utils.WriteSuccessResponse(resp, http.StatusOK, sf.FormatEventInfoResponse())
+	return nil
+}
+
+// Restore recreates a deleted key from the last value in its history.
+func (sih *EventsHandler) Restore(resp http.ResponseWriter, req *http.Request) error {
+	ctx := req.Context()
+	key, ok := mux.Vars(req)["key"]
+	if !ok || len(key) < 1 {
+		return fmt.Errorf("URL query Param 'key' is missing")
+	}
+
+	userId, ok := mux.Vars(req)["user_id"]
+	if !ok || len(userId) < 1 {
+		return fmt.Errorf("URL query Param 'userId' is missing")
+	}
+
+	eventResponse, err := sih.svc.RestoreKey(ctx, &dto.EventQuery{Key: key, UserId: userId})
+	switch {
+	case errors.Is(err, repository.ErrKeyExists):
+		return resperr.NewResponseError(http.StatusConflict, fmt.Sprintf("key %s of user %s is not deleted", key, userId))
+	case errors.Is(err, repository.ErrKeyNotFound):
+		return resperr.NewResponseError(http.StatusNotFound, fmt.Sprintf("no value to restore for key %s of user %s", key, userId))
+	case err != nil:
+		return fmt.Errorf("EventsHandler.Restore . error %v", err)
+	}
+
+	resp.Header().Set(eTagHeader, formatETag(eventResponse.Version))
+	sf := &contract.EventFormatter{EventResponses: eventResponse}
+	utils.WriteSuccessResponse(resp, http.StatusOK, sf.FormatEventInfoResponse())
+	return nil
+}
+
+// Revert sets a key back to the value of a history sequence number or of the
+// latest record at or before an RFC3339 timestamp.
+func (sih *EventsHandler) Revert(resp http.ResponseWriter, req *http.Request) error {
+	ctx := req.Context()
+	key, ok := mux.Vars(req)["key"]
+	if !ok || len(key) < 1 {
+		return fmt.Errorf("URL query Param 'key' is missing")
+	}
+
+	userId, ok := mux.Vars(req)["user_id"]
+	if !ok || len(userId) < 1 {
+		return fmt.Errorf("URL query Param 'userId' is missing")
+	}
+
+	var revertRequest dto.RevertRequest
+	err := utils.ParseRequest(req, &revertRequest)
+	if err != nil {
+		return err
+	}
+
+	ifMatch, err := parseIfMatch(req)
+	if err != nil {
+		return err
+	}
+
+	revertQuery, err := newRevertQuery(revertRequest, dto.EventQuery{Key: key, UserId: userId, Version: ifMatch})
+	if err != nil {
+		return err
+	}
+
+	eventResponse, err := sih.svc.RevertKey(ctx, revertQuery)
+	switch {
+	case errors.Is(err, repository.ErrVersionNotFound):
+		return resperr.NewResponseError(http.StatusNotFound, fmt.Sprintf("no value to revert to for key %s of user %s", key, userId))
+	case errors.Is(err, repository.ErrKeyNotFound):
+		return resperr.NewResponseError(http.StatusNotFound, fmt.Sprintf("key %s not found for user %s", key, userId))
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return versionMismatchError(ifMatch != 0, key, userId)
+	case err != nil:
+		return fmt.Errorf("EventsHandler.Revert . error %v", err)
+	}
+
+	resp.Header().Set(eTagHeader, formatETag(eventResponse.Version))
+	sf := &contract.EventFormatter{EventResponses: eventResponse}
+	utils.WriteSuccessResponse(resp, http.StatusOK, sf.FormatEventInfoResponse())
+	return nil
+}
+
+func newRevertQuery(revertRequest dto.RevertRequest, eventQuery dto.EventQuery) (*dto.RevertQuery, error) {
+	if (revertRequest.Sequence != 0) == (revertRequest.At != "") {
+		return nil, resperr.NewResponseError(http.StatusBadRequest, "exactly one of 'sequence' and 'at' must be set")
+	}
+
+	revertQuery := &dto.RevertQuery{EventQuery: eventQuery, Sequence: revertRequest.Sequence}
+	if revertRequest.At != "" {
+		at, err := time.Parse(time.RFC3339, revertRequest.At)
+		if err != nil {
+			return nil, resperr.NewResponseError(http.StatusBadRequest, "'at' must be an RFC3339 timestamp")
+		}
+		revertQuery.At = at
+	}
+
+	return revertQuery, nil
+}
+
+// Diff shows what changed between two versions of a key.
+func (sih *EventsHandler) Diff(resp http.ResponseWriter, req *http.Request) error {
+	ctx := req.Context()
+	key, ok := mux.Vars(req)["key"]
+	if !ok || len(key) < 1 {
+		return fmt.Errorf("URL query Param 'key' is missing")
+	}
+
+	userId, ok := mux.Vars(req)["user_id"]
+	if !ok || len(userId) < 1 {
+		return fmt.Errorf("URL query Param 'userId' is missing")
+	}
+
+	from, err := parseVersionParam(req, "from")
+	if err != nil {
+		return err
+	}
+
+	to, err := parseVersionParam(req, "to")
+	if err != nil {
+		return err
+	}
+
+	diffResponse, err := sih.svc.Diff(ctx, &dto.DiffQuery{EventQuery: dto.EventQuery{Key: key, UserId: userId}, From: from, To: to})
+	if errors.Is(err, repository.ErrVersionNotFound) {
+		return resperr.NewResponseError(http.StatusNotFound, fmt.Sprintf("key %s of user %s has no value at version %d or %d", key, userId, from, to))
+	} else if err != nil {
+		return fmt.Errorf("EventsHandler.Diff . error %v", err)
+	}
+
+	utils.WriteSuccessResponse(resp, http.StatusOK, diffResponse)
+	return nil
+}
+
+func parseVersionParam(req *http.Request, name string) (int64, error) {
+	version, err := strconv.ParseInt(req.URL.Query().Get(name), 10, 64)
+	if err != nil || version < 1 {
+		return 0, badQueryParam(name, "must be a version number")
+	}
+	return version, nil
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"event-history/pkg/http/internal/resperr"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ascendingOrder  = "asc"
+	descendingOrder = "desc"
+)
+
+var historyActions = map[string]bool{
+	model.CreateAction:  true,
+	model.UpdateAction:  true,
+	model.DeleteAction:  true,
+	model.RestoreAction: true,
+	model.RevertAction:  true,
+	model.ExpireAction:  true,
+}
+
+// parseHistoryQuery reads limit, cursor, from, to, action, archived and order
+// from the URL query of a history request.
+func parseHistoryQuery(req *http.Request, eventQuery dto.EventQuery) (*dto.HistoryQuery, error) {
+	params := req.URL.Query()
+	historyQuery := &dto.HistoryQuery{
+		EventQuery: eventQuery,
+		Limit:      dto.DefaultHistoryLimit,
+		Cursor:     params.Get("cursor"),
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > dto.MaxHistoryLimit {
+			return nil, badQueryParam("limit", fmt.Sprintf("must be between 1 and %d", dto.MaxHistoryLimit))
+		}
+		historyQuery.Limit = n
+	}
+
+	var err error
+	if historyQuery.From, err = parseTimeParam(params.Get("from")); err != nil {
+		return nil, badQueryParam("from", "must be an RFC3339 timestamp")
+	}
+	if historyQuery.To, err = parseTimeParam(params.Get("to")); err != nil {
+		return nil, badQueryParam("to", "must be an RFC3339 timestamp")
+	}
+
+	if actions := params.Get("action"); actions != "" {
+		for _, action := range strings.Split(actions, ",") {
+			action = strings.TrimSpace(action)
+			if !historyActions[action] {
+				return nil, badQueryParam("action", fmt.Sprintf("has unknown action %q", action))
+			}
+			historyQuery.Actions = append(historyQuery.Actions, action)
+		}
+	}
+
+	if archived := params.Get("archived"); archived != "" {
+		includeArchived, err := strconv.ParseBool(archived)
+		if err != nil {
+			return nil, badQueryParam("archived", "must be true or false")
+		}
+		historyQuery.IncludeArchived = includeArchived
+	}
+
+	switch params.Get("order") {
+	case "", ascendingOrder:
+	case descendingOrder:
+		historyQuery.Descending = true
+	default:
+		return nil, badQueryParam("order", "must be asc or desc")
+	}
+
+	return historyQuery, nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func badQueryParam(name, reason string) error {
+	return resperr.NewResponseError(http.StatusBadRequest, fmt.Sprintf("URL query Param '%s' %s", name, reason))
+}
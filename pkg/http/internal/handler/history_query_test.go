@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/http/internal/resperr"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryQuery(t *testing.T) {
+	eventQuery := dto.EventQuery{Key: "name", UserId: "user1"}
+	testCases := map[string]struct {
+		query         string
+		expectedQuery *dto.HistoryQuery
+		expectedCode  int
+	}{
+		"defaults without query params": {
+			query:         "",
+			expectedQuery: &dto.HistoryQuery{EventQuery: eventQuery, Limit: dto.DefaultHistoryLimit},
+		},
+		"all query params": {
+			query: "limit=10&cursor=abc&from=2021-03-01T10:00:00Z&to=2021-03-02T10:00:00Z&action=update,delete&order=desc&archived=true",
+			expectedQuery: &dto.HistoryQuery{
+				EventQuery:      eventQuery,
+				From:            time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC),
+				To:              time.Date(2021, 3, 2, 10, 0, 0, 0, time.UTC),
+				Actions:         []string{"update", "delete"},
+				Descending:      true,
+				Limit:           10,
+				Cursor:          "abc",
+				IncludeArchived: true,
+			},
+		},
+		"limit above maximum": {
+			query:        "limit=100000",
+			expectedCode: http.StatusBadRequest,
+		},
+		"malformed from": {
+			query:        "from=yesterday",
+			expectedCode: http.StatusBadRequest,
+		},
+		"unknown action": {
+			query:        "action=update,rename",
+			expectedCode: http.StatusBadRequest,
+		},
+		"malformed archived": {
+			query:        "archived=maybe",
+			expectedCode: http.StatusBadRequest,
+		},
+		"unknown order": {
+			query:        "order=random",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user1/name?"+testCase.query, nil)
+
+			historyQuery, err := parseHistoryQuery(req, eventQuery)
+
+			assert.Equal(t, testCase.expectedQuery, historyQuery)
+			if testCase.expectedCode == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			respErr, ok := err.(resperr.ResponseError)
+			assert.True(t, ok)
+			assert.Equal(t, testCase.expectedCode, respErr.StatusCode())
+		})
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"errors"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
@@ -19,6 +20,12 @@ func WithErrorHandler(lgr *zap.Logger, next func(resp http.ResponseWriter, req *
 
 		lgr.Error(err.Error())
 
+		var respErr resperr.ResponseError
+		if errors.As(err, &respErr) {
+			utils.WriteFailureResponse(w, respErr)
+			return
+		}
+
 		utils.WriteFailureResponse(w, resperr.NewResponseError(http.StatusInternalServerError, "could not process the request"))
 	}
 }
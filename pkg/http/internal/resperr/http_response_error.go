@@ -3,6 +3,7 @@ package resperr
 type ResponseError struct {
 	statusCode  int
 	description string
+	data        interface{}
 }
 
 func (re ResponseError) StatusCode() int {
@@ -13,9 +14,27 @@ func (re ResponseError) Description() string {
 	return re.description
 }
 
+// Data is sent along with the error description, e.g. the state that made a
+// conditional request fail.
+func (re ResponseError) Data() interface{} {
+	return re.data
+}
+
+func (re ResponseError) Error() string {
+	return re.description
+}
+
 func NewResponseError(statusCode int, description string) ResponseError {
 	return ResponseError{
 		statusCode:  statusCode,
 		description: description,
 	}
 }
+
+func NewResponseErrorWithData(statusCode int, description string, data interface{}) ResponseError {
+	return ResponseError{
+		statusCode:  statusCode,
+		description: description,
+		data:        data,
+	}
+}
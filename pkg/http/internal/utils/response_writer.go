@@ -11,8 +11,12 @@ func WriteSuccessResponse(resp http.ResponseWriter, statusCode int, data interfa
 	writeAPIResponse(resp, statusCode, contract.NewSuccessResponse(data))
 }
 
+func WritePaginatedSuccessResponse(resp http.ResponseWriter, statusCode int, data interface{}, nextCursor string) {
+	writeAPIResponse(resp, statusCode, contract.NewPaginatedSuccessResponse(data, nextCursor))
+}
+
 func WriteFailureResponse(resp http.ResponseWriter, err resperr.ResponseError) {
-	writeAPIResponse(resp, err.StatusCode(), contract.NewFailureResponse(err.Description()))
+	writeAPIResponse(resp, err.StatusCode(), contract.NewFailureResponseWithData(err.Description(), err.Data()))
 }
 
 func writeAPIResponse(resp http.ResponseWriter, code int, ar contract.APIResponse) {
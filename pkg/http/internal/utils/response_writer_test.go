@@ -51,6 +51,17 @@ func TestWriteFailureResponse(t *testing.T) {
 	assert.Equal(t, expectedResp, w.Body.String())
 }
 
+func TestWriteFailureResponse_withData(t *testing.T) {
+	err := resperr.NewResponseErrorWithData(http.StatusConflict, "value mismatch", map[string]string{"Value": "open"})
+
+	w := httptest.NewRecorder()
+
+	utils.WriteFailureResponse(w, err)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `{"data":{"Value":"open"},"error":{"description":"value mismatch"},"success":false}`, w.Body.String())
+}
+
 func testWriteSuccessResponse(t *testing.T, expectedResp string, expectedCode int, inputData interface{}) {
 	w := httptest.NewRecorder()
 
@@ -4,6 +4,7 @@ import (
 	"event-history/pkg/eventinfo"
 	"event-history/pkg/http/internal/handler"
 	"event-history/pkg/http/internal/middleware"
+	"expvar"
 	"net/http"
 
 	"github.com/gorilla/handlers"
@@ -18,10 +19,25 @@ func NewRouter(lgr *zap.Logger, eventsService eventinfo.Service) http.Handler {
 	eventsHandler := handler.NewEventsHandler(lgr, eventsService)
 
 	router.HandleFunc("/", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Create))).Methods(http.MethodPost)
+	router.HandleFunc("/batch", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Batch))).Methods(http.MethodPost)
 	router.HandleFunc("/latest/{user_id}/{key}", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Get))).Methods(http.MethodGet)
 	router.HandleFunc("/", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Update))).Methods(http.MethodPut)
 	router.HandleFunc("/{user_id}/{key}", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Delete))).Methods(http.MethodDelete)
 	router.HandleFunc("/{user_id}/{key}", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.GetHistory))).Methods(http.MethodGet)
+	router.HandleFunc("/{user_id}/{key}/cas", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.CompareAndSwap))).Methods(http.MethodPost)
+	router.HandleFunc("/{user_id}/{key}/restore", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Restore))).Methods(http.MethodPost)
+	router.HandleFunc("/{user_id}/{key}/revert", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Revert))).Methods(http.MethodPost)
+	router.HandleFunc("/{user_id}/{key}/diff", withMiddlewares(lgr, middleware.WithErrorHandler(lgr, eventsHandler.Diff))).Methods(http.MethodGet)
+
+	return router
+}
+
+// NewAdminRouter serves the runtime and connection pool stats at /debug/vars.
+// It exposes the command line and memory stats of the process, so it belongs on
+// the admin listener and never on the public one.
+func NewAdminRouter() http.Handler {
+	router := mux.NewRouter()
+	router.Handle("/debug/vars", expvar.Handler()).Methods(http.MethodGet)
 
 	return router
 }
@@ -17,55 +17,66 @@ type Server interface {
 }
 
 type appServer struct {
-	cfg    config.Config
-	lgr    *zap.Logger
-	router http.Handler
+	cfg         config.Config
+	lgr         *zap.Logger
+	router      http.Handler
+	adminRouter http.Handler
 }
 
+// Start serves the router on the public address and the admin router on the
+// admin address, when there is one, until the process is signalled to stop.
 func (s *appServer) Start() {
-	server := newHTTPServer(s.cfg.GetHTTPServerConfig(), s.router)
+	httpConfig := s.cfg.GetHTTPServerConfig()
+	servers := []*http.Server{newHTTPServer(httpConfig, httpConfig.GetAddress(), s.router)}
+	if address := httpConfig.GetAdminAddress(); address != "" {
+		servers = append(servers, newHTTPServer(httpConfig, address, s.adminRouter))
+	}
 
-	s.lgr.Sugar().Infof("listening on %s", s.cfg.GetHTTPServerConfig().GetAddress())
+	for _, server := range servers {
+		s.lgr.Sugar().Infof("listening on %s", server.Addr)
 
-	go func() {
-		err := server.ListenAndServe()
-		if err != nil {
-			s.lgr.Sugar().Errorf("failed to start server %+v", err)
-		}
-	}()
+		go func(server *http.Server) {
+			err := server.ListenAndServe()
+			if err != nil {
+				s.lgr.Sugar().Errorf("failed to start server %+v", err)
+			}
+		}(server)
+	}
 
-	waitForShutdown(server, s.lgr)
+	waitForShutdown(servers, s.lgr)
 }
 
-func waitForShutdown(server *http.Server, lgr *zap.Logger) {
+func waitForShutdown(servers []*http.Server, lgr *zap.Logger) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	<-sigCh
 
 	defer func() { _ = lgr.Sync() }()
 
-	err := server.Shutdown(context.Background())
-	if err != nil {
-		lgr.Error(err.Error())
-		return
+	for _, server := range servers {
+		if err := server.Shutdown(context.Background()); err != nil {
+			lgr.Error(err.Error())
+			return
+		}
 	}
 
 	lgr.Info("server shutdown successful")
 }
 
-func newHTTPServer(cfg config.HTTPServerConfig, handler http.Handler) *http.Server {
+func newHTTPServer(cfg config.HTTPServerConfig, address string, handler http.Handler) *http.Server {
 	return &http.Server{
 		Handler:      handler,
-		Addr:         cfg.GetAddress(),
+		Addr:         address,
 		WriteTimeout: time.Second * time.Duration(cfg.GetReadTimeout()),
 		ReadTimeout:  time.Second * time.Duration(cfg.GetWriteTimeout()),
 	}
 }
 
-func NewServer(cfg config.Config, lgr *zap.Logger, router http.Handler) Server {
+func NewServer(cfg config.Config, lgr *zap.Logger, router, adminRouter http.Handler) Server {
 	return &appServer{
-		cfg:    cfg,
-		lgr:    lgr,
-		router: router,
+		cfg:         cfg,
+		lgr:         lgr,
+		router:      router,
+		adminRouter: adminRouter,
 	}
 }
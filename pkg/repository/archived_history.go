@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"event-history/pkg/archive"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"sort"
+)
+
+// archivedEventRepository reads history back from the archive for the history
+// queries that ask for it, everything else goes to the wrapped repository.
+type archivedEventRepository struct {
+	EventRepository
+	archive archive.Store
+}
+
+// GetHistory merges the archived records of a key with the ones still in the
+// repository. Both are ordered by sequence, so the cursor of a page works
+// across them.
+func (aer *archivedEventRepository) GetHistory(ctx context.Context, historyQuery *dto.HistoryQuery) ([]model.EventHistory, string, error) {
+	if !historyQuery.IncludeArchived {
+		return aer.EventRepository.GetHistory(ctx, historyQuery)
+	}
+
+	history, nextCursor, err := aer.EventRepository.GetHistory(ctx, historyQuery)
+	if err != nil {
+		return nil, "", err
+	}
+
+	archived, err := aer.archive.History(historyQuery)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get archived history for %s/%s, error: %w", historyQuery.UserId, historyQuery.Key, err)
+	}
+
+	var cursor *historyCursor
+	if historyQuery.Cursor != "" {
+		if cursor, err = decodeHistoryCursor(historyQuery.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	live := make(map[int64]bool, len(history))
+	for _, record := range history {
+		live[record.Sequence] = true
+	}
+
+	for _, record := range archived {
+		if live[record.Sequence] || !matchesHistoryQuery(record, historyQuery, cursor) {
+			continue
+		}
+		history = append(history, record)
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		if historyQuery.Descending {
+			return history[i].Sequence > history[j].Sequence
+		}
+		return history[i].Sequence < history[j].Sequence
+	})
+
+	if historyQuery.Limit <= 0 || (nextCursor == "" && len(history) <= historyQuery.Limit) {
+		return history, "", nil
+	}
+
+	history = history[:historyQuery.Limit]
+	return history, encodeHistoryCursor(history[len(history)-1]), nil
+}
+
+// NewArchivedEventRepository wraps repository so that its history includes the
+// records archived to store when a query asks for them.
+func NewArchivedEventRepository(repository EventRepository, store archive.Store) EventRepository {
+	return &archivedEventRepository{
+		EventRepository: repository,
+		archive:         store,
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const DefaultBlobThreshold = 64 * 1024
+
+// BlobStore keeps large values once in event_blob, addressed by their content
+// hash, so that the snapshot and every history record of a key do not each
+// carry a copy. It works on the transaction of the write it is part of.
+type BlobStore interface {
+	// Offload stores value as a blob when it is over the threshold and returns
+	// its hash. The hash is empty when the value is small enough to stay inline.
+	Offload(tx *gorm.DB, value model.JSONValue) (string, error)
+	// Resolve loads the values of the given hashes.
+	Resolve(tx *gorm.DB, hashes []string) (map[string]model.JSONValue, error)
+	// Prune deletes the blobs of hashes that neither a snapshot nor a history
+	// record refers to any more and returns how many went away.
+	Prune(tx *gorm.DB, hashes []string) (int64, error)
+}
+
+type gormBlobStore struct {
+	threshold int
+}
+
+func (gbs *gormBlobStore) Offload(tx *gorm.DB, value model.JSONValue) (string, error) {
+	if gbs.threshold <= 0 || len(value) <= gbs.threshold {
+		return "", nil
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	blob := model.EventBlob{Hash: hex.EncodeToString(sum[:]), Value: value, Size: int64(len(value))}
+	// a blob that is already stored is updated rather than skipped, which locks
+	// it until the write commits, so that a concurrent Prune passes it over
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hash"}),
+	}).Create(&blob).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to store blob %s, error: %w", blob.Hash, err)
+	}
+
+	return blob.Hash, nil
+}
+
+func (gbs *gormBlobStore) Resolve(tx *gorm.DB, hashes []string) (map[string]model.JSONValue, error) {
+	var blobs []model.EventBlob
+	if err := tx.Where("hash in ?", hashes).Find(&blobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load blobs, error: %w", err)
+	}
+
+	res := make(map[string]model.JSONValue, len(blobs))
+	for _, blob := range blobs {
+		res[blob.Hash] = blob.Value
+	}
+	return res, nil
+}
+
+// Prune locks the unreferenced blobs before deleting them and skips the ones a
+// concurrent Offload holds, as the write of that Offload may be about to refer
+// to the blob without its snapshot or history record being visible yet.
+func (gbs *gormBlobStore) Prune(tx *gorm.DB, hashes []string) (int64, error) {
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+
+	var unused []string
+	err := tx.Model(&model.EventBlob{}).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("hash in ?", hashes).
+		Where("not exists (select 1 from event_snapshot where event_snapshot.blob_hash = event_blob.hash)").
+		Where("not exists (select 1 from event_history where event_history.blob_hash = event_blob.hash)").
+		Pluck("hash", &unused).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find unused blobs, error: %w", err)
+	}
+	if len(unused) == 0 {
+		return 0, nil
+	}
+
+	res := tx.Where("hash in ?", unused).Delete(&model.EventBlob{})
+	return res.RowsAffected, res.Error
+}
+
+// NewBlobStore offloads values larger than threshold bytes, a threshold of
+// zero keeps every value inline.
+func NewBlobStore(threshold int) BlobStore {
+	return &gormBlobStore{
+		threshold: threshold,
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGormEventRepository_blobValues(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepositoryWithBlobStore(dbConn, NewBlobStore(16))
+	document := model.JSONValue(`{"title":"a document larger than the threshold"}`)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "doc", Value: document, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "doc", Value: `"small"`, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "doc", Value: document, UserId: userId}))
+
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "doc", UserId: userId})
+
+	require.NoError(t, err)
+	assert.True(t, snapshot.Value.Equal(document))
+	history, _, err := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "doc", UserId: userId}})
+	require.NoError(t, err)
+	assert.True(t, history[0].Value.Equal(document))
+	assert.Equal(t, model.JSONValue(`"small"`), history[1].Value)
+	assert.True(t, history[2].Value.Equal(document))
+	past, err := repository.GetAnswerAt(ctx, &dto.EventQuery{Key: "doc", UserId: userId}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, past.Value.Equal(document))
+
+	var inline int64
+	dbConn.WithContext(ctx).Model(&model.EventHistory{}).Where("user_id = ? and value is not null", userId).Count(&inline)
+	assert.Equal(t, int64(1), inline)
+	var blobs int64
+	dbConn.WithContext(ctx).Model(&model.EventBlob{}).Where("hash = ?", history[0].BlobHash).Count(&blobs)
+	assert.Equal(t, int64(1), blobs)
+	assert.Equal(t, history[0].BlobHash, history[2].BlobHash)
+
+	swapped, err := repository.CompareAndSwap(ctx, &model.EventSnapshot{Key: "doc", Value: `"done"`, UserId: userId}, document)
+	require.NoError(t, err)
+	assert.Equal(t, "", swapped.BlobHash)
+	report, err := NewSnapshotVerifier(dbConn).Verify(ctx, VerifyOptions{UserId: userId})
+	require.NoError(t, err)
+	assert.Empty(t, report.Drifts)
+}
+
+func TestGormBlobStore_Prune_concurrentOffload(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepositoryWithBlobStore(dbConn, NewBlobStore(16))
+	compactor := NewHistoryCompactor(dbConn)
+	document := model.JSONValue(`{"title":"a document pruned and offloaded at the same time"}`)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "doc", Value: `"small"`, UserId: userId}))
+	// sqlite turns one of two concurrent writers away as busy, as the retrying
+	// repository would, try it again
+	retried := func(fn func() error) error {
+		for {
+			if err := fn(); !IsRetryable(err) {
+				return err
+			}
+		}
+	}
+
+	for round := 0; round < 10; round++ {
+		require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "doc", Value: document, UserId: userId}))
+		require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "doc", Value: `"small"`, UserId: userId}))
+		copyKey := fmt.Sprintf("copy.%d", round)
+
+		var wg sync.WaitGroup
+		var compactErr, createErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			compactErr = retried(func() error {
+				_, err := compactor.Compact(ctx, CompactOptions{Default: RetentionPolicy{KeepVersions: 1}, UserId: userId})
+				return err
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			createErr = retried(func() error {
+				return repository.CreateKey(ctx, &model.EventSnapshot{Key: copyKey, Value: document, UserId: userId})
+			})
+		}()
+		wg.Wait()
+
+		require.NoError(t, compactErr)
+		require.NoError(t, createErr)
+		snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: copyKey, UserId: userId})
+		require.NoError(t, err)
+		assert.True(t, snapshot.Value.Equal(document))
+	}
+}
@@ -1,15 +1,22 @@
 package repository
 
 import (
+	"database/sql"
 	"event-history/pkg/config"
 	"fmt"
+	"time"
 
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 type DBHandler interface {
 	GetDB() (*gorm.DB, error)
+	// GetReplicas opens the read replicas without checking that they are up,
+	// the ReplicaRouter reads from the ones that pass its health checks.
+	GetReplicas() ([]*gorm.DB, error)
 }
 
 type gormDBHandler struct {
@@ -19,7 +26,7 @@ type gormDBHandler struct {
 func (dbHandler *gormDBHandler) GetDB() (*gorm.DB, error) {
 	fmt.Println("DB Connection String:" + dbHandler.config.Address())
 
-	db, err := gorm.Open(postgres.Open(dbHandler.config.Address()), &gorm.Config{})
+	db, err := gorm.Open(dbHandler.dialector(dbHandler.config.Address()), dbHandler.gormConfig())
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to db %w", err)
 	}
@@ -29,6 +36,8 @@ func (dbHandler *gormDBHandler) GetDB() (*gorm.DB, error) {
 		return nil, fmt.Errorf("error %v", err)
 	}
 
+	dbHandler.configurePool(sqlDB)
+
 	err = sqlDB.Ping()
 	if err != nil {
 		return nil, fmt.Errorf("failed to ping. Error %v", err)
@@ -37,6 +46,56 @@ func (dbHandler *gormDBHandler) GetDB() (*gorm.DB, error) {
 	return db, nil
 }
 
+func (dbHandler *gormDBHandler) GetReplicas() ([]*gorm.DB, error) {
+	var replicas []*gorm.DB
+	for _, address := range dbHandler.config.Replicas() {
+		gormConfig := dbHandler.gormConfig()
+		gormConfig.DisableAutomaticPing = true
+
+		db, err := gorm.Open(dbHandler.dialector(address), gormConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open replica %w", err)
+		}
+
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, fmt.Errorf("error %v", err)
+		}
+		dbHandler.configurePool(sqlDB)
+
+		replicas = append(replicas, db)
+	}
+
+	return replicas, nil
+}
+
+// configurePool applies the pool settings of the config, every replica gets a pool of the same size.
+func (dbHandler *gormDBHandler) configurePool(sqlDB *sql.DB) {
+	sqlDB.SetMaxOpenConns(dbHandler.config.MaxOpenConns())
+	sqlDB.SetMaxIdleConns(dbHandler.config.MaxIdleConns())
+	sqlDB.SetConnMaxLifetime(dbHandler.config.ConnMaxLifetime())
+}
+
+func (dbHandler *gormDBHandler) dialector(address string) gorm.Dialector {
+	switch dbHandler.config.Driver() {
+	case config.SQLiteDriver:
+		return sqlite.Open(address)
+	case config.MySQLDriver:
+		return mysql.Open(address)
+	default:
+		return postgres.Open(address)
+	}
+}
+
+func (dbHandler *gormDBHandler) gormConfig() *gorm.Config {
+	if dbHandler.config.Driver() == config.SQLiteDriver {
+		// sqlite keeps timestamps as text, so they only compare correctly in a single zone
+		return &gorm.Config{NowFunc: func() time.Time { return time.Now().UTC() }}
+	}
+
+	return &gorm.Config{}
+}
+
 func NewDBHandler(config config.DBConfig) DBHandler {
 	return &gormDBHandler{
 		config: config,
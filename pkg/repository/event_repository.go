@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"event-history/pkg/eventinfo/dto"
 	"event-history/pkg/eventinfo/model"
 	"fmt"
@@ -9,136 +11,808 @@ import (
 	"time"
 )
 
+var (
+	ErrKeyNotFound     = errors.New("key not found")
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrValueMismatch   = errors.New("value mismatch")
+	ErrKeyExists       = errors.New("key exists")
+	ErrVersionNotFound = errors.New("version not found")
+)
+
 //go:generate moq -out mock/EventRepository.go -pkg mock . EventRepository
 type EventRepository interface {
 	CreateKey(ctx context.Context, eventInfo *model.EventSnapshot) error
 	GetAnswer(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error)
+	GetAnswerAt(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*model.EventSnapshot, error)
 	DeleteKey(ctx context.Context, query *dto.EventQuery) error
 	UpdateKey(ctx context.Context, info *model.EventSnapshot) error
-	GetHistory(ctx context.Context, query *dto.EventQuery) ([]model.EventHistory, error)
+	GetHistory(ctx context.Context, query *dto.HistoryQuery) ([]model.EventHistory, string, error)
+	ApplyBatch(ctx context.Context, batchId string, operations []dto.BatchOperation) ([]model.EventHistory, error)
+	CompareAndSwap(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error)
+	RestoreKey(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error)
+	RevertKey(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error)
+	GetVersion(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error)
+	ExpireKeys(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error)
 }
 
+// QueryTimeouts bound how long the reads, the writes and the batches of the
+// repository may take.
+type QueryTimeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Batch time.Duration
+}
+
+var DefaultQueryTimeouts = QueryTimeouts{Read: time.Second, Write: time.Second, Batch: time.Second}
+
 type gormEventRepository struct {
-	db *gorm.DB
+	uow      UnitOfWork
+	blobs    BlobStore
+	reads    ReadRouter
+	timeouts QueryTimeouts
 }
 
 func (gbr *gormEventRepository) CreateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	gbr.reads.Wrote(eventInfo.UserId)
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Write)
 	defer cancel()
-	tx := gbr.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
 
-	queryResult := gbr.db.WithContext(ctx).Create(&eventInfo)
-	if queryResult.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("create key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, queryResult.Error)
+	return gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		_, err := gbr.createKey(tx, eventInfo, "")
+		return err
+	})
+}
+
+// UpdateKey bumps the version of the key. A non zero eventInfo.Version is treated
+// as the version the caller expects to overwrite, ErrVersionMismatch is returned
+// when the key has moved on. On success eventInfo.Version holds the new version.
+func (gbr *gormEventRepository) UpdateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
+	gbr.reads.Wrote(eventInfo.UserId)
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Write)
+	defer cancel()
+
+	expected := eventInfo.Version
+	err := gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		eventInfo.Version = expected
+		_, err := gbr.updateKey(tx, eventInfo, "")
+		return err
+	})
+	if err != nil {
+		eventInfo.Version = expected
 	}
 
-	queryResult = tx.WithContext(ctx).Create(model.NewHistoryRecord(eventInfo, model.CreateAction))
-	if queryResult.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to historize create event for %s/%s, error: %+v", eventInfo.Key, eventInfo.UserId, queryResult.Error)
+	return err
+}
+
+func (gbr *gormEventRepository) GetAnswer(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+	var res model.EventSnapshot
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Read)
+	defer cancel()
+
+	reader := gbr.reads.Reader(eventQuery.UserId).WithContext(ctx)
+	db := reader.Where(keyCondition(eventQuery.Key, eventQuery.UserId)).Scopes(unexpired(time.Now())).First(&res)
+	if db.Error != nil {
+		return nil, fmt.Errorf("get answer for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, db.Error)
 	}
 
-	tx.Commit()
-	return nil
+	if err := gbr.resolveSnapshot(reader, &res); err != nil {
+		return nil, fmt.Errorf("get answer for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, err)
+	}
+
+	return &res, nil
 }
 
-func (gbr *gormEventRepository) UpdateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
+// GetAnswerAt replays event_history to find the value a key held at the given instant.
+// ErrKeyNotFound is returned when the key did not exist yet or was deleted at that time.
+// The instant is compared in UTC, which is how sqlite keeps its timestamps as text.
+func (gbr *gormEventRepository) GetAnswerAt(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*model.EventSnapshot, error) {
+	var res model.EventHistory
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Read)
 	defer cancel()
-	tx := gbr.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
 
-	result := tx.WithContext(ctx).Where("key = ? and user_id = ?", eventInfo.Key, eventInfo.UserId).Updates(eventInfo)
-	if result.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("update key for: %s key for %s user failed. error %+v", eventInfo.Key, eventInfo.UserId, result.Error)
-	} else if result.RowsAffected == 0 {
-		tx.Rollback()
-		return fmt.Errorf("update key for: %s key for %s not found", eventInfo.Key, eventInfo.UserId)
+	reader := gbr.reads.Reader(eventQuery.UserId).WithContext(ctx)
+	db := reader.
+		Where(keyCondition(eventQuery.Key, eventQuery.UserId)).
+		Where("created_at <= ?", at.UTC()).
+		Order("created_at desc, sequence desc").
+		Limit(1).
+		Find(&res)
+	if db.Error != nil {
+		return nil, fmt.Errorf("get answer at %s for: %s key for %s user failed: %w", at.Format(time.RFC3339), eventQuery.Key, eventQuery.UserId, db.Error)
 	}
 
-	result = tx.WithContext(ctx).Create(model.NewHistoryRecord(eventInfo, model.UpdateAction))
-	if result.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to historize update event for %s/%s, error: %+v", eventInfo.Key, eventInfo.UserId, result.Error)
+	if db.RowsAffected == 0 || res.RemovesKey() {
+		return nil, fmt.Errorf("get answer at %s for: %s key for %s user: %w", at.Format(time.RFC3339), eventQuery.Key, eventQuery.UserId, ErrKeyNotFound)
 	}
 
-	tx.Commit()
+	history := []model.EventHistory{res}
+	if err := gbr.resolveHistory(reader, history); err != nil {
+		return nil, fmt.Errorf("get answer at %s for: %s key for %s user failed: %w", at.Format(time.RFC3339), eventQuery.Key, eventQuery.UserId, err)
+	}
+	res = history[0]
 
-	return nil
+	return &model.EventSnapshot{Key: res.Key, Value: res.Value, ValueType: res.ValueType, UserId: res.UserId, Version: res.Version}, nil
 }
 
-func (gbr *gormEventRepository) GetAnswer(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
-	var res model.EventSnapshot
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
+// GetVersion returns the history record that set the key to eventQuery.Version.
+// Versions keep counting when a deleted key is created again, so a version names
+// a single record. ErrVersionNotFound is returned when there is none.
+func (gbr *gormEventRepository) GetVersion(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error) {
+	var res model.EventHistory
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Read)
 	defer cancel()
 
-	db := gbr.db.WithContext(ctx).Where("key = ? and user_id = ?", eventQuery.Key, eventQuery.UserId).First(&res)
+	reader := gbr.reads.Reader(eventQuery.UserId).WithContext(ctx)
+	db := reader.
+		Where(keyCondition(eventQuery.Key, eventQuery.UserId)).
+		Where("version = ?", eventQuery.Version).
+		Order("sequence desc").
+		Limit(1).
+		Find(&res)
 	if db.Error != nil {
-		return nil, fmt.Errorf("get answer for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, db.Error)
+		return nil, fmt.Errorf("get version %d for: %s key for %s user failed: %w", eventQuery.Version, eventQuery.Key, eventQuery.UserId, db.Error)
+	} else if db.RowsAffected == 0 {
+		return nil, fmt.Errorf("get version %d for: %s key for %s user: %w", eventQuery.Version, eventQuery.Key, eventQuery.UserId, ErrVersionNotFound)
 	}
 
-	return &res, nil
+	history := []model.EventHistory{res}
+	if err := gbr.resolveHistory(reader, history); err != nil {
+		return nil, fmt.Errorf("get version %d for: %s key for %s user failed: %w", eventQuery.Version, eventQuery.Key, eventQuery.UserId, err)
+	}
+
+	return &history[0], nil
+}
+
+// ExpireKeys removes up to limit keys that have expired by now and records an
+// expire for each of them. The records are returned in expiry order, fewer than
+// limit of them means that no expired key is left.
+func (gbr *gormEventRepository) ExpireKeys(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error) {
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Write)
+	defer cancel()
+
+	var res []model.EventHistory
+	err := gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		var expired []model.EventSnapshot
+		err := tx.Select("key", "user_id", "version").
+			Scopes(expiredBy(now)).
+			Order("expires_at").
+			Limit(limit).
+			Find(&expired).Error
+		if err != nil {
+			return fmt.Errorf("failed to find expired keys, error: %w", err)
+		}
+
+		res = make([]model.EventHistory, 0, len(expired))
+		for _, snapshot := range expired {
+			record, err := expireKey(tx, snapshot)
+			if err != nil {
+				return err
+			} else if record != nil {
+				res = append(res, *record)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
 }
 
+// DeleteKey removes the snapshot of a key. A non zero eventquery.Version makes the
+// delete conditional on the key still being at that version.
 func (gbr *gormEventRepository) DeleteKey(ctx context.Context, eventquery *dto.EventQuery) error {
+	gbr.reads.Wrote(eventquery.UserId)
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Write)
+	defer cancel()
+
+	return gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		_, err := gbr.deleteKey(tx, eventquery, "")
+		return err
+	})
+}
+
+// ApplyBatch runs the operations in order in a single transaction, either all
+// of them are applied or none is. The history records written are returned in
+// operation order and all carry batchId.
+func (gbr *gormEventRepository) ApplyBatch(ctx context.Context, batchId string, operations []dto.BatchOperation) ([]model.EventHistory, error) {
+	for _, operation := range operations {
+		gbr.reads.Wrote(operation.UserId)
+	}
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Batch)
+	defer cancel()
+
+	var res []model.EventHistory
+	err := gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		res = make([]model.EventHistory, 0, len(operations))
+		for i, operation := range operations {
+			record, err := gbr.applyOperation(tx, operation, batchId)
+			if err != nil {
+				return fmt.Errorf("batch %s operation %d failed: %w", batchId, i, err)
+			}
+			res = append(res, *record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CompareAndSwap sets the value of the key to eventInfo.Value only if it currently
+// holds the same JSON as expected. It returns the snapshot after the swap, or the
+// current snapshot along with ErrValueMismatch when the key holds something else.
+func (gbr *gormEventRepository) CompareAndSwap(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error) {
+	gbr.reads.Wrote(eventInfo.UserId)
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Write)
+	defer cancel()
+
+	var current model.EventSnapshot
+	err := gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		result := tx.Where(keyCondition(eventInfo.Key, eventInfo.UserId)).Scopes(unexpired(time.Now())).First(&current)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("compare and swap for: %s key for %s not found: %w", eventInfo.Key, eventInfo.UserId, ErrKeyNotFound)
+		} else if result.Error != nil {
+			return fmt.Errorf("compare and swap for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, result.Error)
+		}
+
+		if err := gbr.resolveSnapshot(tx, &current); err != nil {
+			return fmt.Errorf("compare and swap for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, err)
+		}
+
+		if !current.Value.Equal(expected) {
+			return fmt.Errorf("compare and swap for: %s key for %s user expected %s: %w", eventInfo.Key, eventInfo.UserId, expected, ErrValueMismatch)
+		}
+
+		swapped := &model.EventSnapshot{Key: eventInfo.Key, Value: eventInfo.Value, UserId: eventInfo.UserId, Version: current.Version}
+		_, err := gbr.updateKey(tx, swapped, "")
+		if errors.Is(err, ErrVersionMismatch) {
+			return fmt.Errorf("compare and swap for: %s key for %s user raced with another write: %w", eventInfo.Key, eventInfo.UserId, ErrValueMismatch)
+		} else if err != nil {
+			return err
+		}
+
+		current = *swapped
+		return nil
+	})
+	if errors.Is(err, ErrValueMismatch) {
+		return &current, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &current, nil
+}
+
+// RestoreKey recreates the snapshot of a deleted key from its last history record
+// that is not a delete and records a restore. ErrKeyExists is returned when the
+// key has a snapshot and ErrKeyNotFound when there is no value to restore.
+func (gbr *gormEventRepository) RestoreKey(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+	gbr.reads.Wrote(eventQuery.UserId)
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Write)
+	defer cancel()
+
 	var res model.EventSnapshot
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	err := gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		if err := expireStale(tx, eventQuery.Key, eventQuery.UserId); err != nil {
+			return fmt.Errorf("restore key for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, err)
+		}
+
+		var snapshots int64
+		if err := tx.Model(&model.EventSnapshot{}).Where(keyCondition(eventQuery.Key, eventQuery.UserId)).Count(&snapshots).Error; err != nil {
+			return fmt.Errorf("restore key for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, err)
+		} else if snapshots > 0 {
+			return fmt.Errorf("restore key for: %s key for %s user: %w", eventQuery.Key, eventQuery.UserId, ErrKeyExists)
+		}
+
+		var last, source model.EventHistory
+		result := tx.Where(keyCondition(eventQuery.Key, eventQuery.UserId)).Order("sequence desc").Limit(1).Find(&last)
+		if result.Error != nil {
+			return fmt.Errorf("restore key for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, result.Error)
+		}
+
+		result = tx.Where(keyCondition(eventQuery.Key, eventQuery.UserId)).
+			Where("action not in ?", model.RemovingActions).
+			Order("sequence desc").
+			Limit(1).
+			Find(&source)
+		if result.Error != nil {
+			return fmt.Errorf("restore key for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, result.Error)
+		} else if result.RowsAffected == 0 {
+			return fmt.Errorf("restore key for: %s key for %s user has no value to restore: %w", eventQuery.Key, eventQuery.UserId, ErrKeyNotFound)
+		}
+
+		res = model.EventSnapshot{
+			Key:       eventQuery.Key,
+			Value:     source.Value,
+			ValueType: source.ValueType,
+			UserId:    eventQuery.UserId,
+			Version:   last.Version + 1,
+			BlobHash:  source.BlobHash,
+		}
+		if err := tx.Create(&res).Error; err != nil {
+			return fmt.Errorf("restore key for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, err)
+		}
+
+		if err := historize(tx, model.NewHistoryRecord(&res, model.RestoreAction)); err != nil {
+			return fmt.Errorf("failed to historize restore event for %s/%s, error: %w", eventQuery.Key, eventQuery.UserId, err)
+		}
+
+		return gbr.resolveSnapshot(tx, &res)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// RevertKey sets the key back to the value of one of its history records and
+// records a revert referring to that record's version. A non zero
+// revertQuery.Version makes the revert conditional as it does for UpdateKey.
+// ErrVersionNotFound is returned when the record does not exist or is a delete.
+func (gbr *gormEventRepository) RevertKey(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error) {
+	gbr.reads.Wrote(revertQuery.UserId)
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Write)
+	defer cancel()
+
+	var res *model.EventSnapshot
+	err := gbr.uow.Do(ctx, func(tx *gorm.DB) error {
+		record, err := gbr.revertKey(tx, revertQuery)
+		if err != nil {
+			return err
+		}
+
+		res = &model.EventSnapshot{Key: record.Key, Value: record.Value, ValueType: record.ValueType, UserId: record.UserId, Version: record.Version}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetHistory returns one page of a key's history along with the cursor of the
+// next page, which is empty once the last page has been read.
+func (gbr *gormEventRepository) GetHistory(ctx context.Context, historyQuery *dto.HistoryQuery) ([]model.EventHistory, string, error) {
+	var res []model.EventHistory
+	ctx, cancel := context.WithTimeout(ctx, gbr.timeouts.Read)
 	defer cancel()
-	tx := gbr.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+
+	reader := gbr.reads.Reader(historyQuery.UserId).WithContext(ctx)
+	db := reader.Where(keyCondition(historyQuery.Key, historyQuery.UserId))
+	if !historyQuery.From.IsZero() {
+		db = db.Where("created_at >= ?", historyQuery.From.UTC())
+	}
+	if !historyQuery.To.IsZero() {
+		db = db.Where("created_at < ?", historyQuery.To.UTC())
+	}
+	if len(historyQuery.Actions) > 0 {
+		db = db.Where("action in ?", historyQuery.Actions)
+	}
+
+	if historyQuery.Cursor != "" {
+		cursor, err := decodeHistoryCursor(historyQuery.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if historyQuery.Descending {
+			db = db.Where("sequence < ?", cursor.Sequence)
+		} else {
+			db = db.Where("sequence > ?", cursor.Sequence)
 		}
-	}()
+	}
+
+	if historyQuery.Descending {
+		db = db.Order("sequence desc")
+	} else {
+		db = db.Order("sequence")
+	}
+
+	if historyQuery.Limit > 0 {
+		db = db.Limit(historyQuery.Limit + 1)
+	}
+
+	db = db.Find(&res)
+	if db.Error != nil {
+		return nil, "", fmt.Errorf("failed to get history for %s/%s, error: %+v", historyQuery.UserId, historyQuery.Key, db.Error)
+	}
+
+	if err := gbr.resolveHistory(reader, res); err != nil {
+		return nil, "", fmt.Errorf("failed to get history for %s/%s, error: %w", historyQuery.UserId, historyQuery.Key, err)
+	}
+
+	if historyQuery.Limit <= 0 || len(res) <= historyQuery.Limit {
+		return res, "", nil
+	}
+
+	res = res[:historyQuery.Limit]
+	return res, encodeHistoryCursor(res[len(res)-1]), nil
+}
+
+func (gbr *gormEventRepository) applyOperation(tx *gorm.DB, operation dto.BatchOperation, batchId string) (*model.EventHistory, error) {
+	switch operation.Action {
+	case model.CreateAction:
+		return gbr.createKey(tx, &model.EventSnapshot{Key: operation.Key, Value: operation.Value, UserId: operation.UserId}, batchId)
+	case model.UpdateAction:
+		return gbr.updateKey(tx, &model.EventSnapshot{Key: operation.Key, Value: operation.Value, UserId: operation.UserId, Version: operation.Version}, batchId)
+	case model.DeleteAction:
+		return gbr.deleteKey(tx, &dto.EventQuery{Key: operation.Key, UserId: operation.UserId, Version: operation.Version}, batchId)
+	}
 
-	execResult := gbr.db.WithContext(ctx).Unscoped().Where("key = ? and user_id = ?", eventquery.Key, eventquery.UserId).Delete(&res)
+	return nil, fmt.Errorf("unknown batch action %q for %s/%s", operation.Action, operation.Key, operation.UserId)
+}
+
+func (gbr *gormEventRepository) createKey(tx *gorm.DB, eventInfo *model.EventSnapshot, batchId string) (*model.EventHistory, error) {
+	if err := expireStale(tx, eventInfo.Key, eventInfo.UserId); err != nil {
+		return nil, fmt.Errorf("create key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, err)
+	}
+
+	lastVersion, err := lastVersion(tx, eventInfo.Key, eventInfo.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("create key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, err)
+	}
+
+	eventInfo.Version = lastVersion + 1
+	eventInfo.ValueType = eventInfo.Value.Type()
+	if err := gbr.offload(tx, eventInfo); err != nil {
+		return nil, fmt.Errorf("create key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, err)
+	}
+
+	row := *eventInfo
+	if row.BlobHash != "" {
+		row.Value = ""
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, fmt.Errorf("create key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, err)
+	}
+
+	record := model.NewHistoryRecord(eventInfo, model.CreateAction)
+	record.BatchId = batchId
+	if err := historize(tx, record); err != nil {
+		return nil, fmt.Errorf("failed to historize create event for %s/%s, error: %w", eventInfo.Key, eventInfo.UserId, err)
+	}
+
+	return record, nil
+}
+
+func (gbr *gormEventRepository) updateKey(tx *gorm.DB, eventInfo *model.EventSnapshot, batchId string) (*model.EventHistory, error) {
+	if err := gbr.setValue(tx, eventInfo); err != nil {
+		return nil, err
+	}
+
+	record := model.NewHistoryRecord(eventInfo, model.UpdateAction)
+	record.BatchId = batchId
+	if err := historize(tx, record); err != nil {
+		return nil, fmt.Errorf("failed to historize update event for %s/%s, error: %w", eventInfo.Key, eventInfo.UserId, err)
+	}
+
+	return record, nil
+}
+
+func (gbr *gormEventRepository) revertKey(tx *gorm.DB, revertQuery *dto.RevertQuery) (*model.EventHistory, error) {
+	db := tx.Where(keyCondition(revertQuery.Key, revertQuery.UserId))
+	if revertQuery.Sequence != 0 {
+		db = db.Where("sequence = ?", revertQuery.Sequence)
+	} else {
+		db = db.Where("created_at <= ?", revertQuery.At.UTC()).Order("created_at desc, sequence desc")
+	}
+
+	var source model.EventHistory
+	result := db.Limit(1).Find(&source)
+	if result.Error != nil {
+		return nil, fmt.Errorf("revert key for: %s key for %s user failed. error %w", revertQuery.Key, revertQuery.UserId, result.Error)
+	} else if result.RowsAffected == 0 || source.RemovesKey() {
+		return nil, fmt.Errorf("revert key for: %s key for %s user has no value to revert to: %w", revertQuery.Key, revertQuery.UserId, ErrVersionNotFound)
+	}
+
+	history := []model.EventHistory{source}
+	if err := gbr.resolveHistory(tx, history); err != nil {
+		return nil, fmt.Errorf("revert key for: %s key for %s user failed. error %w", revertQuery.Key, revertQuery.UserId, err)
+	}
+
+	eventInfo := &model.EventSnapshot{Key: revertQuery.Key, Value: history[0].Value, UserId: revertQuery.UserId, Version: revertQuery.Version}
+	if err := gbr.setValue(tx, eventInfo); err != nil {
+		return nil, err
+	}
+
+	record := model.NewHistoryRecord(eventInfo, model.RevertAction)
+	record.SourceVersion = source.Version
+	if err := historize(tx, record); err != nil {
+		return nil, fmt.Errorf("failed to historize revert event for %s/%s, error: %w", revertQuery.Key, revertQuery.UserId, err)
+	}
+
+	return record, nil
+}
+
+// setValue writes eventInfo.Value to the snapshot of an existing key and bumps its
+// version, the caller records the change in the history.
+func (gbr *gormEventRepository) setValue(tx *gorm.DB, eventInfo *model.EventSnapshot) error {
+	var current model.EventSnapshot
+	result := tx.Where(keyCondition(eventInfo.Key, eventInfo.UserId)).Scopes(unexpired(time.Now())).First(&current)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("update key for: %s key for %s not found: %w", eventInfo.Key, eventInfo.UserId, ErrKeyNotFound)
+	} else if result.Error != nil {
+		return fmt.Errorf("update key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, result.Error)
+	}
+
+	if eventInfo.Version != 0 && eventInfo.Version != current.Version {
+		return fmt.Errorf("update key for: %s key for %s user at version %d, current version %d: %w", eventInfo.Key, eventInfo.UserId, eventInfo.Version, current.Version, ErrVersionMismatch)
+	}
+
+	if eventInfo.ExpiresAt == nil {
+		eventInfo.ExpiresAt = current.ExpiresAt
+	}
+
+	eventInfo.Version = current.Version + 1
+	eventInfo.ValueType = eventInfo.Value.Type()
+	if err := gbr.offload(tx, eventInfo); err != nil {
+		return fmt.Errorf("update key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, err)
+	}
+
+	result = tx.Model(&model.EventSnapshot{}).
+		Where(keyCondition(eventInfo.Key, eventInfo.UserId)).
+		Where("version = ?", current.Version).
+		Updates(snapshotValueColumns(eventInfo))
+	if result.Error != nil {
+		return fmt.Errorf("update key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, result.Error)
+	} else if result.RowsAffected == 0 {
+		return fmt.Errorf("update key for: %s key for %s user raced with another write: %w", eventInfo.Key, eventInfo.UserId, ErrVersionMismatch)
+	}
+
+	return nil
+}
+
+func (gbr *gormEventRepository) deleteKey(tx *gorm.DB, eventquery *dto.EventQuery, batchId string) (*model.EventHistory, error) {
+	var res model.EventSnapshot
+	execResult := tx.Where(keyCondition(eventquery.Key, eventquery.UserId)).Scopes(unexpired(time.Now())).First(&res)
+	if errors.Is(execResult.Error, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("record not found for %s key %s user: %w", eventquery.Key, eventquery.UserId, ErrKeyNotFound)
+	} else if execResult.Error != nil {
+		return nil, fmt.Errorf("delete key for: %s key for %s user failed: %w", eventquery.Key, eventquery.UserId, execResult.Error)
+	}
+
+	if eventquery.Version != 0 && eventquery.Version != res.Version {
+		return nil, fmt.Errorf("delete key for: %s key for %s user at version %d, current version %d: %w", eventquery.Key, eventquery.UserId, eventquery.Version, res.Version, ErrVersionMismatch)
+	}
+
+	execResult = tx.Unscoped().
+		Where(keyCondition(eventquery.Key, eventquery.UserId)).
+		Where("version = ?", res.Version).
+		Delete(&model.EventSnapshot{})
 	if execResult.Error != nil {
-		return fmt.Errorf("delete key for: %s key for %s user failed: %w", eventquery.Key, eventquery.UserId, execResult.Error)
+		return nil, fmt.Errorf("delete key for: %s key for %s user failed: %w", eventquery.Key, eventquery.UserId, execResult.Error)
 	} else if execResult.RowsAffected == 0 {
-		tx.Rollback()
-		return fmt.Errorf("record not found for %s key %s user", eventquery.Key, eventquery.UserId)
+		return nil, fmt.Errorf("delete key for: %s key for %s user raced with another write: %w", eventquery.Key, eventquery.UserId, ErrVersionMismatch)
 	}
 
-	execResult = tx.WithContext(ctx).Create(model.NewHistoryRecord(
-		&model.EventSnapshot{Key: eventquery.Key, UserId: eventquery.UserId},
-		model.DeleteAction),
+	record := model.NewHistoryRecord(
+		&model.EventSnapshot{Key: eventquery.Key, UserId: eventquery.UserId, Version: res.Version + 1},
+		model.DeleteAction,
 	)
-	if execResult.Error != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to historize delete event for %s/%s, error: %+v", eventquery.Key, eventquery.UserId, execResult.Error)
+	record.BatchId = batchId
+	if err := historize(tx, record); err != nil {
+		return nil, fmt.Errorf("failed to historize delete event for %s/%s, error: %w", eventquery.Key, eventquery.UserId, err)
+	}
+
+	return record, nil
+}
+
+// expireKey removes the snapshot of a key that has expired and records an expire.
+// It does nothing when the key has been written to since the snapshot was read.
+func expireKey(tx *gorm.DB, snapshot model.EventSnapshot) (*model.EventHistory, error) {
+	result := tx.Unscoped().
+		Where(keyCondition(snapshot.Key, snapshot.UserId)).
+		Where("version = ?", snapshot.Version).
+		Delete(&model.EventSnapshot{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("expire key for: %s key for %s user failed: %w", snapshot.Key, snapshot.UserId, result.Error)
+	} else if result.RowsAffected == 0 {
+		return nil, nil
 	}
 
-	tx.Commit()
+	record := model.NewHistoryRecord(
+		&model.EventSnapshot{Key: snapshot.Key, UserId: snapshot.UserId, Version: snapshot.Version + 1},
+		model.ExpireAction,
+	)
+	if err := historize(tx, record); err != nil {
+		return nil, fmt.Errorf("failed to historize expire event for %s/%s, error: %w", snapshot.Key, snapshot.UserId, err)
+	}
+
+	return record, nil
+}
 
+// expireStale expires the snapshot of a key that has expired but has not been
+// reaped yet, so that the key can be written again.
+func expireStale(tx *gorm.DB, key, userId string) error {
+	var expired []model.EventSnapshot
+	if err := tx.Where(keyCondition(key, userId)).Scopes(expiredBy(time.Now())).Find(&expired).Error; err != nil {
+		return err
+	}
+
+	for _, snapshot := range expired {
+		if _, err := expireKey(tx, snapshot); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (gbr *gormEventRepository) GetHistory(ctx context.Context, eventQuery *dto.EventQuery) ([]model.EventHistory, error) {
-	var res []model.EventHistory
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
-	defer cancel()
+// lastVersion is the version of the last history record of a key, zero when it
+// has none. A key that is created again carries on from it, so that a version
+// never names two values and a stale If-Match cannot match the new key.
+func lastVersion(tx *gorm.DB, key, userId string) (int64, error) {
+	var last model.EventHistory
+	result := tx.Select("version").Where(keyCondition(key, userId)).Order("sequence desc").Limit(1).Find(&last)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to get last version: %w", result.Error)
+	}
+	return last.Version, nil
+}
 
-	db := gbr.db.WithContext(ctx).Where("key = ? and user_id = ?", eventQuery.Key, eventQuery.UserId).Order("created_at").Find(&res)
-	if db.Error != nil {
-		return nil, fmt.Errorf("failed to get history for %s/%s, error: %+v", eventQuery.UserId, eventQuery.Key, db.Error)
+// historize appends a record to the key's history with the next gap-free
+// sequence number. It has to run inside the transaction that changed the snapshot
+// and locks the key's history first, so that concurrent writers of the key take
+// their sequence numbers one after the other.
+func historize(tx *gorm.DB, record *model.EventHistory) error {
+	if err := lockHistory(tx, record.Key, record.UserId); err != nil {
+		return fmt.Errorf("failed to lock history: %w", err)
 	}
 
-	return res, nil
+	var sequence int64
+	err := tx.Model(&model.EventHistory{}).
+		Where(keyCondition(record.Key, record.UserId)).
+		Select("coalesce(max(sequence), 0) + 1").
+		Scan(&sequence).Error
+	if err != nil {
+		return fmt.Errorf("failed to get next sequence: %w", err)
+	}
+
+	record.Sequence = sequence
+	row := *record
+	if row.BlobHash != "" {
+		row.Value = ""
+	}
+	return tx.Create(&row).Error
+}
+
+// lockHistory holds a transaction level advisory lock on the history of a key
+// on postgres, whose partitioned event_history cannot have a unique
+// (user_id, key, sequence) index. On the other databases that index rejects the
+// writer that loses the race for a sequence number instead.
+func lockHistory(tx *gorm.DB, key, userId string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("select pg_advisory_xact_lock(hashtext(?), hashtext(?))", userId, key).Error
+}
+
+// offload moves a large value to the blob store and records its hash on the
+// snapshot, whose Value is left as is for the caller.
+func (gbr *gormEventRepository) offload(tx *gorm.DB, eventInfo *model.EventSnapshot) error {
+	hash, err := gbr.blobs.Offload(tx, eventInfo.Value)
+	if err != nil {
+		return err
+	}
+
+	eventInfo.BlobHash = hash
+	return nil
+}
+
+func (gbr *gormEventRepository) resolveSnapshot(tx *gorm.DB, snapshot *model.EventSnapshot) error {
+	if snapshot.BlobHash == "" {
+		return nil
+	}
+
+	blobs, err := gbr.blobs.Resolve(tx, []string{snapshot.BlobHash})
+	if err != nil {
+		return err
+	}
+
+	value, ok := blobs[snapshot.BlobHash]
+	if !ok {
+		return fmt.Errorf("blob %s of %s/%s is missing", snapshot.BlobHash, snapshot.UserId, snapshot.Key)
+	}
+	snapshot.Value = value
+	return nil
+}
+
+// resolveHistory fills in the values of the records that refer to a blob.
+func (gbr *gormEventRepository) resolveHistory(tx *gorm.DB, history []model.EventHistory) error {
+	return resolveHistoryBlobs(tx, gbr.blobs, history)
+}
+
+func resolveHistoryBlobs(tx *gorm.DB, blobStore BlobStore, history []model.EventHistory) error {
+	var hashes []string
+	for _, record := range history {
+		if record.BlobHash != "" {
+			hashes = append(hashes, record.BlobHash)
+		}
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	blobs, err := blobStore.Resolve(tx, hashes)
+	if err != nil {
+		return err
+	}
+
+	for i := range history {
+		if history[i].BlobHash == "" {
+			continue
+		}
+
+		value, ok := blobs[history[i].BlobHash]
+		if !ok {
+			return fmt.Errorf("blob %s of %s/%s is missing", history[i].BlobHash, history[i].UserId, history[i].Key)
+		}
+		history[i].Value = value
+	}
+	return nil
+}
+
+// snapshotValueColumns are the columns an update of the value writes. The value
+// column is NULL when the value lives in the blob store.
+func snapshotValueColumns(eventInfo *model.EventSnapshot) map[string]interface{} {
+	columns := map[string]interface{}{
+		"value":      eventInfo.Value,
+		"value_type": eventInfo.ValueType,
+		"version":    eventInfo.Version,
+		"blob_hash":  sql.NullString{String: eventInfo.BlobHash, Valid: eventInfo.BlobHash != ""},
+		"expires_at": eventInfo.ExpiresAt,
+	}
+	if eventInfo.BlobHash != "" {
+		columns["value"] = model.JSONValue("")
+	}
+	return columns
+}
+
+// unexpired leaves out the snapshots that have expired by now but have not been
+// reaped yet. Expiry times are kept in UTC.
+func unexpired(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(expires_at is null or expires_at > ?)", now.UTC())
+	}
+}
+
+func expiredBy(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("expires_at <= ?", now.UTC())
+	}
+}
+
+// keyCondition matches one key of a user. gorm quotes the column names of map
+// conditions for the active dialect, which matters as key is reserved in mysql.
+func keyCondition(key, userId string) map[string]interface{} {
+	return map[string]interface{}{"key": key, "user_id": userId}
 }
 
 func NewEventRepository(db *gorm.DB) EventRepository {
+	return NewEventRepositoryWithBlobStore(db, NewBlobStore(DefaultBlobThreshold))
+}
+
+func NewEventRepositoryWithBlobStore(db *gorm.DB, blobs BlobStore) EventRepository {
+	return NewEventRepositoryWithReadRouter(db, blobs, NewPrimaryRouter(db))
+}
+
+// NewEventRepositoryWithReadRouter writes to db and reads from the connection
+// reads picks, which may be a replica.
+func NewEventRepositoryWithReadRouter(db *gorm.DB, blobs BlobStore, reads ReadRouter) EventRepository {
+	return NewEventRepositoryWithTimeouts(db, blobs, reads, DefaultQueryTimeouts)
+}
+
+func NewEventRepositoryWithTimeouts(db *gorm.DB, blobs BlobStore, reads ReadRouter, timeouts QueryTimeouts) EventRepository {
 	return &gormEventRepository{
-		db: db,
+		uow:      NewUnitOfWork(db),
+		blobs:    blobs,
+		reads:    reads,
+		timeouts: timeouts,
 	}
 }
@@ -2,12 +2,17 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"event-history/pkg/config"
 	"event-history/pkg/eventinfo/dto"
 	"event-history/pkg/eventinfo/model"
 	"github.com/smartystreets/assertions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
+	"sync"
 	"testing"
+	"time"
 )
 
 const userId = "test_user"
@@ -27,11 +32,11 @@ func setUp() (*gorm.DB, context.Context) {
 }
 func TestGormEventRepository_GetAnswer(t *testing.T) {
 	dbConn, ctx := setUp()
-	expectedEvent := model.EventSnapshot{"name", "john", userId}
+	expectedEvent := model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 	dbConn.WithContext(ctx).Create(expectedEvent)
 	repository := NewEventRepository(dbConn)
 
-	eventSnapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{"name", userId})
+	eventSnapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
 
 	assertions.So(err, assertions.ShouldBeNil)
 	assertions.ShouldEqual(eventSnapshot, expectedEvent)
@@ -42,19 +47,32 @@ func TestGormEventRepository_GetAnswer_fails(t *testing.T) {
 	dbConn, ctx := setUp()
 	repository := NewEventRepository(dbConn)
 
-	eventSnapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{"name", userId})
+	eventSnapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
 
 	assertions.So(eventSnapshot, assertions.ShouldBeNil)
 	assertions.ShouldContain(err.Error(), "record not found")
 }
 
+func TestGormEventRepository_timeouts(t *testing.T) {
+	dbConn, ctx := setUp()
+	timeouts := QueryTimeouts{Read: time.Nanosecond, Write: time.Second, Batch: time.Second}
+	repository := NewEventRepositoryWithTimeouts(dbConn, NewBlobStore(DefaultBlobThreshold), NewPrimaryRouter(dbConn), timeouts)
+
+	err := repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId})
+	require.NoError(t, err)
+	eventSnapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+
+	assert.Nil(t, eventSnapshot)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
 func TestGormEventRepository_DeleteAnswer(t *testing.T) {
 	dbConn, ctx := setUp()
-	event := model.EventSnapshot{"name", "", userId}
+	event := model.EventSnapshot{Key: "name", Value: `""`, UserId: userId}
 	dbConn.WithContext(ctx).Create(event)
 	repository := NewEventRepository(dbConn)
 
-	err := repository.DeleteKey(ctx, &dto.EventQuery{"name", userId})
+	err := repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId})
 
 	assertions.So(err, assertions.ShouldBeNil)
 	checkForEmptyHistory(dbConn, ctx)
@@ -68,7 +86,7 @@ func TestGormEventRepository_DeleteAnswer_fails(t *testing.T) {
 	dbConn, ctx := setUp()
 	repository := NewEventRepository(dbConn)
 
-	err := repository.DeleteKey(ctx, &dto.EventQuery{"name", userId})
+	err := repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId})
 
 	assertions.ShouldContain(err.Error(), "record not found")
 	checkForEmptyHistory(dbConn, ctx)
@@ -77,10 +95,10 @@ func TestGormEventRepository_DeleteAnswer_fails(t *testing.T) {
 
 func TestGormEventRepository_UpdateKey(t *testing.T) {
 	dbConn, ctx := setUp()
-	event := &model.EventSnapshot{"name", "john", userId}
+	event := &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 	dbConn.WithContext(ctx).Create(event)
 	repository := NewEventRepository(dbConn)
-	updateEvent := &model.EventSnapshot{"name", "sam", userId}
+	updateEvent := &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}
 
 	err := repository.UpdateKey(ctx, updateEvent)
 
@@ -94,7 +112,7 @@ func TestGormEventRepository_UpdateKey(t *testing.T) {
 func TestGormEventRepository_UpdateKey_fails(t *testing.T) {
 	dbConn, ctx := setUp()
 	repository := NewEventRepository(dbConn)
-	updateEvent := &model.EventSnapshot{"name", "sam", userId}
+	updateEvent := &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}
 
 	err := repository.UpdateKey(ctx, updateEvent)
 
@@ -106,7 +124,7 @@ func TestGormEventRepository_UpdateKey_fails(t *testing.T) {
 func TestGormEventRepository_CreateKey(t *testing.T) {
 	dbConn, ctx := setUp()
 	repository := NewEventRepository(dbConn)
-	createEvent := &model.EventSnapshot{"name", "sam", userId}
+	createEvent := &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}
 
 	err := repository.CreateKey(ctx, createEvent)
 
@@ -120,10 +138,10 @@ func TestGormEventRepository_CreateKey(t *testing.T) {
 
 func TestGormEventRepository_CreateKey_fails(t *testing.T) {
 	dbConn, ctx := setUp()
-	event := &model.EventSnapshot{"name", "john", userId}
+	event := &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
 	dbConn.WithContext(ctx).Create(event)
 	repository := NewEventRepository(dbConn)
-	createEvent := &model.EventSnapshot{"name", "sam", userId}
+	createEvent := &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}
 
 	err := repository.CreateKey(ctx, createEvent)
 
@@ -134,15 +152,15 @@ func TestGormEventRepository_CreateKey_fails(t *testing.T) {
 func TestGormEventRepository_GetHistory(t *testing.T) {
 	dbConn, ctx := setUp()
 	repository := NewEventRepository(dbConn)
-	createEvent := &model.EventSnapshot{"name", "john", userId}
-	updateEvent := &model.EventSnapshot{"name", "sam", userId}
-	deleteEvent := &dto.EventQuery{"name", userId}
+	createEvent := &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
+	updateEvent := &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}
+	deleteEvent := &dto.EventQuery{Key: "name", UserId: userId}
 
 	repository.CreateKey(ctx, createEvent)
 	repository.UpdateKey(ctx, updateEvent)
 	repository.DeleteKey(ctx, deleteEvent)
 
-	historyRecords, err := repository.GetHistory(ctx, &dto.EventQuery{"name", userId})
+	historyRecords, _, err := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
 
 	assertions.So(err, assertions.ShouldBeNil)
 	assertions.ShouldEqual(len(historyRecords), 3)
@@ -151,6 +169,359 @@ func TestGormEventRepository_GetHistory(t *testing.T) {
 	assertions.ShouldEqual(historyRecords[0], model.NewHistoryRecord(&model.EventSnapshot{Key: "name", UserId: userId}, model.DeleteAction))
 }
 
+func TestGormEventRepository_UpdateKey_versioned(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	createEvent := &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
+	assert.NoError(t, repository.CreateKey(ctx, createEvent))
+	assert.Equal(t, int64(1), createEvent.Version)
+
+	updateEvent := &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId, Version: 1}
+	assert.NoError(t, repository.UpdateKey(ctx, updateEvent))
+	assert.Equal(t, int64(2), updateEvent.Version)
+
+	staleEvent := &model.EventSnapshot{Key: "name", Value: `"tom"`, UserId: userId, Version: 1}
+	err := repository.UpdateKey(ctx, staleEvent)
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+
+	err = repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId, Version: 1})
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+	assert.NoError(t, err)
+	assert.Equal(t, model.JSONValue(`"sam"`), snapshot.Value)
+	assert.Equal(t, int64(2), snapshot.Version)
+
+	assert.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId, Version: 2}))
+	history, _, err := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versionsOf(history))
+	assert.Equal(t, []int64{1, 2, 3}, sequencesOf(history))
+	assert.True(t, history[0].Offset < history[1].Offset && history[1].Offset < history[2].Offset)
+
+	assert.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"ann"`, UserId: userId}))
+	history, _, err = repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}, Descending: true, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), history[0].Sequence)
+	assert.Equal(t, int64(4), history[0].Version, "a key created again carries on from its last version")
+}
+
+func TestGormEventRepository_UpdateKey_concurrent(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId})
+		}()
+	}
+	wg.Wait()
+
+	history, _, err := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+	require.NoError(t, err)
+	for i, record := range history {
+		assert.Equal(t, int64(i+1), record.Sequence, "writers of a key take their sequences one after the other")
+		assert.Equal(t, int64(i+1), record.Version)
+	}
+}
+
+func TestGormEventRepository_GetHistory_paginated(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	dbConn.WithContext(ctx).Create(&[]model.EventHistory{
+		{Key: "name", Value: `"john"`, UserId: userId, Action: model.CreateAction, CreatedAt: start, Sequence: 1},
+		{Key: "name", Value: `"sam"`, UserId: userId, Action: model.UpdateAction, CreatedAt: start.Add(time.Minute), Sequence: 2},
+		{Key: "name", Value: `"tom"`, UserId: userId, Action: model.UpdateAction, CreatedAt: start.Add(2 * time.Minute), Sequence: 3},
+		{Key: "name", UserId: userId, Action: model.DeleteAction, CreatedAt: start.Add(3 * time.Minute), Sequence: 4},
+	})
+	query := &dto.HistoryQuery{
+		EventQuery: dto.EventQuery{Key: "name", UserId: userId},
+		Actions:    []string{model.UpdateAction, model.DeleteAction},
+		Descending: true,
+		Limit:      2,
+	}
+
+	firstPage, cursor, err := repository.GetHistory(ctx, query)
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cursor)
+	assert.Equal(t, 2, len(firstPage))
+	assert.Equal(t, model.DeleteAction, firstPage[0].Action)
+	assert.Equal(t, model.JSONValue(`"tom"`), firstPage[1].Value)
+
+	query.Cursor = cursor
+	secondPage, cursor, err := repository.GetHistory(ctx, query)
+
+	assert.NoError(t, err)
+	assert.Empty(t, cursor)
+	assert.Equal(t, 1, len(secondPage))
+	assert.Equal(t, model.JSONValue(`"sam"`), secondPage[0].Value)
+
+	query.Cursor = "not-a-cursor"
+	_, _, err = repository.GetHistory(ctx, query)
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
+
+func TestGormEventRepository_GetAnswerAt(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	query := &dto.EventQuery{Key: "name", UserId: userId}
+	createdAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	deletedAt := updatedAt.Add(time.Hour)
+	dbConn.WithContext(ctx).Create(&[]model.EventHistory{
+		{Key: "name", Value: `"john"`, UserId: userId, Action: model.CreateAction, CreatedAt: createdAt, Sequence: 1},
+		{Key: "name", Value: `"sam"`, UserId: userId, Action: model.UpdateAction, CreatedAt: updatedAt, Sequence: 2},
+		{Key: "name", UserId: userId, Action: model.DeleteAction, CreatedAt: deletedAt, Sequence: 3},
+	})
+
+	snapshot, err := repository.GetAnswerAt(ctx, query, updatedAt.Add(time.Minute))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}, snapshot)
+
+	_, err = repository.GetAnswerAt(ctx, query, createdAt.Add(-time.Minute))
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+
+	snapshot, err = repository.GetAnswerAt(ctx, query, updatedAt.Add(time.Minute).In(time.FixedZone("UTC-5", -5*60*60)))
+
+	require.NoError(t, err, "an instant in another zone is the same instant")
+	assert.Equal(t, model.JSONValue(`"sam"`), snapshot.Value)
+
+	_, err = repository.GetAnswerAt(ctx, query, deletedAt.Add(time.Minute))
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestGormEventRepository_ApplyBatch(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "city", Value: `"pune"`, UserId: userId}))
+
+	history, err := repository.ApplyBatch(ctx, "batch-1", []dto.BatchOperation{
+		{Action: model.CreateAction, Key: "name", Value: `"john"`, UserId: userId},
+		{Action: model.UpdateAction, Key: "name", Value: `"sam"`, UserId: userId, Version: 1},
+		{Action: model.DeleteAction, Key: "city", UserId: userId},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 2}, versionsOf(history))
+	var batchRecords []model.EventHistory
+	dbConn.WithContext(ctx).Where("batch_id = ?", "batch-1").Order("event_offset").Find(&batchRecords)
+	assert.Equal(t, []int64{1, 2, 2}, sequencesOf(batchRecords))
+	var unbatched int64
+	dbConn.WithContext(ctx).Model(&model.EventHistory{}).Where("user_id = ? and batch_id is null", userId).Count(&unbatched)
+	assert.Equal(t, int64(1), unbatched)
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+	require.NoError(t, err)
+	assert.Equal(t, model.JSONValue(`"sam"`), snapshot.Value)
+}
+
+func TestGormEventRepository_ApplyBatch_allOrNothing(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "city", Value: `"pune"`, UserId: userId}))
+
+	history, err := repository.ApplyBatch(ctx, "batch-2", []dto.BatchOperation{
+		{Action: model.CreateAction, Key: "name", Value: `"john"`, UserId: userId},
+		{Action: model.UpdateAction, Key: "city", Value: `"mumbai"`, UserId: userId, Version: 7},
+	})
+
+	assert.Nil(t, history)
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+	_, err = repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	var count int64
+	dbConn.WithContext(ctx).Model(&model.EventHistory{}).Where("user_id = ?", userId).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestGormEventRepository_CompareAndSwap(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "state", Value: `"open"`, UserId: userId}))
+
+	swapped, err := repository.CompareAndSwap(ctx, &model.EventSnapshot{Key: "state", Value: `"closed"`, UserId: userId}, `"open"`)
+
+	require.NoError(t, err)
+	assert.Equal(t, &model.EventSnapshot{Key: "state", Value: `"closed"`, ValueType: model.StringValue, UserId: userId, Version: 2}, swapped)
+
+	current, err := repository.CompareAndSwap(ctx, &model.EventSnapshot{Key: "state", Value: `"reopened"`, UserId: userId}, `"open"`)
+
+	assert.True(t, errors.Is(err, ErrValueMismatch))
+	assert.Equal(t, &model.EventSnapshot{Key: "state", Value: `"closed"`, ValueType: model.StringValue, UserId: userId, Version: 2}, current)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "state", UserId: userId}})
+	assert.Equal(t, []int64{1, 2}, versionsOf(history))
+	assert.Equal(t, model.JSONValue(`"closed"`), history[1].Value)
+
+	_, err = repository.CompareAndSwap(ctx, &model.EventSnapshot{Key: "missing", Value: `"x"`, UserId: userId}, "")
+
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestGormEventRepository_RestoreKey(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"jane"`, UserId: userId}))
+
+	_, err := repository.RestoreKey(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+
+	assert.True(t, errors.Is(err, ErrKeyExists))
+
+	require.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId}))
+
+	restored, err := repository.RestoreKey(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+
+	require.NoError(t, err)
+	assert.Equal(t, &model.EventSnapshot{Key: "name", Value: `"jane"`, ValueType: model.StringValue, UserId: userId, Version: 4}, restored)
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+	require.NoError(t, err)
+	assert.Equal(t, restored, snapshot)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+	assert.Equal(t, []int64{1, 2, 3, 4}, versionsOf(history))
+	assert.Equal(t, model.RestoreAction, history[3].Action)
+	assert.Equal(t, model.JSONValue(`"jane"`), history[3].Value)
+
+	_, err = repository.RestoreKey(ctx, &dto.EventQuery{Key: "missing", UserId: userId})
+
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestGormEventRepository_RevertKey(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"jane"`, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}))
+
+	reverted, err := repository.RevertKey(ctx, &dto.RevertQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}, Sequence: 1})
+
+	require.NoError(t, err)
+	assert.Equal(t, &model.EventSnapshot{Key: "name", Value: `"john"`, ValueType: model.StringValue, UserId: userId, Version: 4}, reverted)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+	assert.Equal(t, []int64{1, 2, 3, 4}, versionsOf(history))
+	assert.Equal(t, model.RevertAction, history[3].Action)
+	assert.Equal(t, int64(1), history[3].SourceVersion)
+
+	_, err = repository.RevertKey(ctx, &dto.RevertQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId, Version: 3}, Sequence: 2})
+
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+
+	_, err = repository.RevertKey(ctx, &dto.RevertQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}, Sequence: 9})
+
+	assert.True(t, errors.Is(err, ErrVersionNotFound))
+	snapshot, _ := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+	assert.Equal(t, reverted, snapshot)
+}
+
+func TestGormEventRepository_GetVersion(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"jane"`, UserId: userId}))
+
+	record, err := repository.GetVersion(ctx, &dto.EventQuery{Key: "name", UserId: userId, Version: 1})
+
+	require.NoError(t, err)
+	assert.Equal(t, model.JSONValue(`"john"`), record.Value)
+	assert.Equal(t, int64(1), record.Sequence)
+
+	record, err = repository.GetVersion(ctx, &dto.EventQuery{Key: "name", UserId: userId, Version: 3})
+
+	require.NoError(t, err, "the key created again carries on after the delete")
+	assert.Equal(t, model.JSONValue(`"jane"`), record.Value)
+	assert.Equal(t, int64(3), record.Sequence)
+
+	_, err = repository.GetVersion(ctx, &dto.EventQuery{Key: "name", UserId: userId, Version: 5})
+
+	assert.True(t, errors.Is(err, ErrVersionNotFound))
+}
+
+func TestGormEventRepository_ExpireKeys(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	expired := time.Now().UTC().Add(-time.Minute)
+	later := time.Now().UTC().Add(time.Hour)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "session", Value: `"abc"`, UserId: userId, ExpiresAt: &expired}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "theme", Value: `"dark"`, UserId: userId, ExpiresAt: &later}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "theme", Value: `"light"`, UserId: userId}))
+
+	_, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "session", UserId: userId})
+
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	err = repository.UpdateKey(ctx, &model.EventSnapshot{Key: "session", Value: `"def"`, UserId: userId})
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+	theme, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "theme", UserId: userId})
+	require.NoError(t, err)
+	assert.WithinDuration(t, later, *theme.ExpiresAt, time.Millisecond)
+
+	records, err := repository.ExpireKeys(ctx, time.Now(), 10)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, model.ExpireAction, records[0].Action)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "session", UserId: userId}})
+	assert.Equal(t, []string{model.CreateAction, model.ExpireAction}, []string{history[0].Action, history[1].Action})
+	assert.Equal(t, []int64{1, 2}, versionsOf(history))
+
+	expiredAgain := time.Now().UTC().Add(-time.Second)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "session", Value: `"def"`, UserId: userId, ExpiresAt: &expiredAgain}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "session", Value: `"ghi"`, UserId: userId}))
+
+	session, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "session", UserId: userId})
+	require.NoError(t, err)
+	assert.Equal(t, model.JSONValue(`"ghi"`), session.Value)
+	assert.Nil(t, session.ExpiresAt)
+}
+
+func TestGormEventRepository_jsonValues(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "profile", Value: `{"name":"john","age":30}`, UserId: userId}))
+
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "profile", UserId: userId})
+
+	require.NoError(t, err)
+	assert.Equal(t, model.ObjectValue, snapshot.ValueType)
+	assert.True(t, snapshot.Value.Equal(`{"age":30,"name":"john"}`))
+
+	swapped, err := repository.CompareAndSwap(ctx, &model.EventSnapshot{Key: "profile", Value: `[1,2]`, UserId: userId}, `{"age": 30, "name": "john"}`)
+
+	require.NoError(t, err)
+	assert.Equal(t, model.ArrayValue, swapped.ValueType)
+	require.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "profile", UserId: userId}))
+	history, _, err := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "profile", UserId: userId}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{model.ObjectValue, model.ArrayValue, ""}, []string{history[0].ValueType, history[1].ValueType, history[2].ValueType})
+	assert.Equal(t, model.JSONValue(""), history[2].Value)
+
+	err = repository.CreateKey(ctx, &model.EventSnapshot{Key: "broken", Value: "john", UserId: userId})
+
+	assert.Error(t, err)
+}
+
+func versionsOf(history []model.EventHistory) []int64 {
+	var versions []int64
+	for _, record := range history {
+		versions = append(versions, record.Version)
+	}
+	return versions
+}
+
+func sequencesOf(history []model.EventHistory) []int64 {
+	var sequences []int64
+	for _, record := range history {
+		sequences = append(sequences, record.Sequence)
+	}
+	return sequences
+}
+
 func checkForEmptyHistory(dbConn *gorm.DB, ctx context.Context) {
 	var historyRecords []*model.EventHistory
 	dbConn.WithContext(ctx).Find(&historyRecords)
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"event-history/pkg/archive"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultArchiveBatchSize = 1000
+
+// ArchiveOptions moves the history records created before Before, of one user
+// when UserId is set. With DryRun nothing is written and the deletes are
+// rolled back.
+type ArchiveOptions struct {
+	Before    time.Time
+	UserId    string
+	BatchSize int
+	DryRun    bool
+}
+
+// ArchiveResult sums up an archive run.
+type ArchiveResult struct {
+	DryRun      bool  `json:"dry_run"`
+	Records     int64 `json:"records"`
+	Segments    int   `json:"segments"`
+	PrunedBlobs int64 `json:"pruned_blobs"`
+}
+
+type HistoryArchiver interface {
+	Archive(ctx context.Context, opts ArchiveOptions) (*ArchiveResult, error)
+}
+
+type gormHistoryArchiver struct {
+	uow     UnitOfWork
+	blobs   BlobStore
+	archive archive.Store
+}
+
+// Archive moves BatchSize records per transaction into the archive. A batch
+// is written to the archive before its records are deleted, so a failed
+// commit leaves them in both places rather than in none. The latest record of
+// a key is never archived, as the snapshot of the key corresponds to it.
+func (gha *gormHistoryArchiver) Archive(ctx context.Context, opts ArchiveOptions) (*ArchiveResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultArchiveBatchSize
+	}
+
+	result := &ArchiveResult{DryRun: opts.DryRun}
+	var after int64
+	for {
+		var records []model.EventHistory
+		err := gha.uow.Do(ctx, func(tx *gorm.DB) error {
+			var err error
+			if records, err = archivableHistory(tx, opts, after); err != nil {
+				return err
+			}
+
+			if len(records) == 0 {
+				return nil
+			}
+
+			result.Records += int64(len(records))
+			if opts.DryRun {
+				return errRollback
+			}
+
+			segments, blobs, err := gha.archiveRecords(tx, records)
+			if err != nil {
+				return err
+			}
+			result.Segments += segments
+			result.PrunedBlobs += blobs
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(records) < opts.BatchSize {
+			return result, nil
+		}
+		after = records[len(records)-1].Offset
+	}
+}
+
+func (gha *gormHistoryArchiver) archiveRecords(tx *gorm.DB, records []model.EventHistory) (int, int64, error) {
+	var hashes []string
+	offsets := make([]int64, 0, len(records))
+	for _, record := range records {
+		offsets = append(offsets, record.Offset)
+		if record.BlobHash != "" {
+			hashes = append(hashes, record.BlobHash)
+		}
+	}
+
+	if err := resolveHistoryBlobs(tx, gha.blobs, records); err != nil {
+		return 0, 0, fmt.Errorf("failed to archive history, error: %w", err)
+	}
+
+	segments, err := gha.archive.Write(records)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to archive history, error: %w", err)
+	}
+
+	if err := tx.Where("event_offset in ?", offsets).Delete(&model.EventHistory{}).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to delete archived history, error: %w", err)
+	}
+
+	blobs, err := gha.blobs.Prune(tx, hashes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prune archived blobs, error: %w", err)
+	}
+	return len(segments), blobs, nil
+}
+
+// archivableHistory pages through the records created before opts.Before that
+// are not the latest of their key, ordered by event_offset.
+func archivableHistory(tx *gorm.DB, opts ArchiveOptions, after int64) ([]model.EventHistory, error) {
+	var records []model.EventHistory
+	err := tx.Scopes(keyScope(opts.UserId, "")).
+		Where("created_at < ?", opts.Before.UTC()).
+		Where("event_offset > ?", after).
+		Where(clause.Expr{
+			SQL: "sequence < (select max(latest.sequence) from event_history latest where latest.user_id = event_history.user_id and ? = ?)",
+			Vars: []interface{}{
+				clause.Column{Table: "latest", Name: "key"},
+				clause.Column{Table: "event_history", Name: "key"},
+			},
+		}).
+		Order("event_offset").
+		Limit(opts.BatchSize).
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find history to archive, error: %w", err)
+	}
+	return records, nil
+}
+
+// NewHistoryArchiver moves history from db into store.
+func NewHistoryArchiver(db *gorm.DB, store archive.Store) HistoryArchiver {
+	return &gormHistoryArchiver{
+		uow:     NewUnitOfWork(db),
+		blobs:   NewBlobStore(0),
+		archive: store,
+	}
+}
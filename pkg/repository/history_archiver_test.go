@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"event-history/pkg/archive"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGormHistoryArchiver_Archive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dbConn, ctx := setUp()
+	repository := NewEventRepositoryWithBlobStore(dbConn, NewBlobStore(16))
+	document := model.JSONValue(`{"title":"a document only the archived version of doc holds"}`)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "doc", Value: document, UserId: userId}))
+	for _, value := range []model.JSONValue{`"jane"`, `"sam"`, `"max"`} {
+		require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "doc", Value: value, UserId: userId}))
+	}
+	dbConn.WithContext(ctx).Model(&model.EventHistory{}).
+		Where(keyCondition("doc", userId)).
+		Update("created_at", time.Now().UTC().Add(-48*time.Hour))
+	store := archive.NewFileStore(dir)
+	archiver := NewHistoryArchiver(dbConn, store)
+	opts := ArchiveOptions{Before: time.Now().Add(-24 * time.Hour), UserId: userId, BatchSize: 2, DryRun: true}
+
+	result, err := archiver.Archive(ctx, opts)
+
+	require.NoError(t, err)
+	assert.Equal(t, &ArchiveResult{DryRun: true, Records: 3}, result)
+	assert.Equal(t, int64(4), countRows(dbConn, &model.EventHistory{}))
+
+	opts.DryRun = false
+	result, err = archiver.Archive(ctx, opts)
+
+	require.NoError(t, err)
+	assert.Equal(t, &ArchiveResult{Records: 3, Segments: 2, PrunedBlobs: 1}, result)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "doc", UserId: userId}})
+	assert.Equal(t, []int64{4}, sequencesOf(history))
+
+	archived := NewArchivedEventRepository(repository, store)
+	historyQuery := &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "doc", UserId: userId}, Limit: 3, IncludeArchived: true}
+	history, cursor, err := archived.GetHistory(ctx, historyQuery)
+
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, sequencesOf(history))
+	assert.Equal(t, document, history[0].Value)
+
+	historyQuery.Cursor = cursor
+	history, cursor, err = archived.GetHistory(ctx, historyQuery)
+
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4}, sequencesOf(history))
+	assert.Empty(t, cursor)
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultCompactBatchSize = 500
+
+// RetentionPolicy keeps the last KeepVersions history records of a key and
+// every record younger than KeepFor, anything else is pruned. A zero value
+// leaves that bound out and a policy without either keeps the whole history.
+type RetentionPolicy struct {
+	KeyPrefix    string
+	KeepVersions int
+	KeepFor      time.Duration
+}
+
+// CompactOptions applies to every key the override with the longest KeyPrefix
+// it starts with, or Default when none matches. An empty UserId compacts the
+// history of all users. With DryRun the prunes run but are rolled back.
+type CompactOptions struct {
+	Default   RetentionPolicy
+	Overrides []RetentionPolicy
+	UserId    string
+	BatchSize int
+	DryRun    bool
+}
+
+// CompactResult sums up a compaction. PrunedByPolicy counts the records pruned
+// under each policy by its KeyPrefix, the default policy has the empty prefix.
+type CompactResult struct {
+	DryRun         bool             `json:"dry_run"`
+	Keys           int              `json:"keys"`
+	CompactedKeys  int              `json:"compacted_keys"`
+	PrunedRecords  int64            `json:"pruned_records"`
+	PrunedBlobs    int64            `json:"pruned_blobs"`
+	PrunedByPolicy map[string]int64 `json:"pruned_by_policy"`
+}
+
+type HistoryCompactor interface {
+	Compact(ctx context.Context, opts CompactOptions) (*CompactResult, error)
+}
+
+type gormHistoryCompactor struct {
+	uow   UnitOfWork
+	blobs BlobStore
+}
+
+// historyKey is a key that has history along with the size of it.
+type historyKey struct {
+	UserId       string `gorm:"column:user_id"`
+	Key          string `gorm:"column:key"`
+	LastSequence int64  `gorm:"column:last_sequence"`
+	Records      int64  `gorm:"column:records"`
+}
+
+// Compact prunes the history of BatchSize keys per transaction. The latest
+// record of a key is never pruned, as the snapshot of the key corresponds to it.
+// Blobs only referred to by pruned records are removed along with them.
+func (ghc *gormHistoryCompactor) Compact(ctx context.Context, opts CompactOptions) (*CompactResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultCompactBatchSize
+	}
+
+	now := time.Now()
+	result := &CompactResult{DryRun: opts.DryRun, PrunedByPolicy: map[string]int64{}}
+	var after *historyKey
+	for {
+		var keys []historyKey
+		err := ghc.uow.Do(ctx, func(tx *gorm.DB) error {
+			var err error
+			if keys, err = historyKeys(tx, keyScope(opts.UserId, ""), after, opts.BatchSize); err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				policy := opts.policyFor(key.Key)
+				records, blobs, err := compactKey(tx, ghc.blobs, key, policy, now)
+				if err != nil {
+					return err
+				}
+
+				result.Keys++
+				if records > 0 {
+					result.CompactedKeys++
+					result.PrunedRecords += records
+					result.PrunedBlobs += blobs
+					result.PrunedByPolicy[policy.KeyPrefix] += records
+				}
+			}
+
+			if opts.DryRun {
+				return errRollback
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) < opts.BatchSize {
+			return result, nil
+		}
+		after = &keys[len(keys)-1]
+	}
+}
+
+func (opts CompactOptions) policyFor(key string) RetentionPolicy {
+	policy := opts.Default
+	matched := -1
+	for _, override := range opts.Overrides {
+		if strings.HasPrefix(key, override.KeyPrefix) && len(override.KeyPrefix) > matched {
+			policy, matched = override, len(override.KeyPrefix)
+		}
+	}
+	return policy
+}
+
+// historyKeys pages through the keys in scope that have history, ordered by
+// (user_id, key).
+func historyKeys(tx *gorm.DB, scope func(*gorm.DB) *gorm.DB, after *historyKey, limit int) ([]historyKey, error) {
+	query := tx.Model(&model.EventHistory{}).
+		Select("user_id, ?, max(sequence) as last_sequence, count(*) as records", clause.Column{Name: "key"}).
+		Scopes(scope)
+	if after != nil {
+		query = query.Where(keysAfter(*after))
+	}
+
+	var keys []historyKey
+	err := query.
+		Clauses(
+			clause.GroupBy{Columns: []clause.Column{{Name: "user_id"}, {Name: "key"}}},
+			// Order drops a clause.OrderBy, it only takes a column or a string
+			clause.OrderBy{Columns: []clause.OrderByColumn{
+				{Column: clause.Column{Name: "user_id"}},
+				{Column: clause.Column{Name: "key"}},
+			}},
+		).
+		Limit(limit).
+		Scan(&keys).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history keys, error: %w", err)
+	}
+	return keys, nil
+}
+
+// compactKey prunes the records of a key the policy does not keep and returns
+// how many records and blobs went away.
+func compactKey(tx *gorm.DB, blobStore BlobStore, key historyKey, policy RetentionPolicy, now time.Time) (int64, int64, error) {
+	if policy.KeepVersions <= 0 && policy.KeepFor <= 0 {
+		return 0, 0, nil
+	}
+
+	keepFrom := key.LastSequence
+	if policy.KeepVersions > 0 {
+		if key.Records <= int64(policy.KeepVersions) {
+			return 0, 0, nil
+		}
+		if from := key.LastSequence - int64(policy.KeepVersions) + 1; from < keepFrom {
+			keepFrom = from
+		}
+	}
+
+	pruned := func(db *gorm.DB) *gorm.DB {
+		db = db.Where(keyCondition(key.Key, key.UserId)).Where("sequence < ?", keepFrom)
+		if policy.KeepFor > 0 {
+			db = db.Where("created_at < ?", now.Add(-policy.KeepFor).UTC())
+		}
+		return db
+	}
+
+	var hashes []string
+	err := tx.Model(&model.EventHistory{}).
+		Scopes(pruned).
+		Where("blob_hash is not null").
+		Distinct("blob_hash").
+		Pluck("blob_hash", &hashes).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find blobs of %s/%s, error: %w", key.UserId, key.Key, err)
+	}
+
+	deleted := tx.Scopes(pruned).Delete(&model.EventHistory{})
+	if deleted.Error != nil {
+		return 0, 0, fmt.Errorf("failed to prune history of %s/%s, error: %w", key.UserId, key.Key, deleted.Error)
+	}
+
+	blobs, err := blobStore.Prune(tx, hashes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prune blobs of %s/%s, error: %w", key.UserId, key.Key, err)
+	}
+
+	return deleted.RowsAffected, blobs, nil
+}
+
+func NewHistoryCompactor(db *gorm.DB) HistoryCompactor {
+	return &gormHistoryCompactor{
+		uow:   NewUnitOfWork(db),
+		blobs: NewBlobStore(0),
+	}
+}
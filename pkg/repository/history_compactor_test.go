@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGormHistoryCompactor_Compact(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepositoryWithBlobStore(dbConn, NewBlobStore(16))
+	document := model.JSONValue(`{"title":"a document only the first version of doc holds"}`)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "doc", Value: document, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "session.a", Value: `"john"`, UserId: userId}))
+	for _, value := range []model.JSONValue{`"jane"`, `"sam"`} {
+		require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "doc", Value: value, UserId: userId}))
+		require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: value, UserId: userId}))
+		require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "session.a", Value: value, UserId: userId}))
+	}
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"max"`, UserId: userId}))
+	dbConn.WithContext(ctx).Model(&model.EventHistory{}).
+		Where(keyCondition("session.a", userId)).
+		Update("created_at", time.Now().UTC().Add(-48*time.Hour))
+	opts := CompactOptions{
+		Default:   RetentionPolicy{KeepVersions: 2},
+		Overrides: []RetentionPolicy{{KeyPrefix: "session.", KeepFor: 24 * time.Hour}},
+		UserId:    userId,
+		BatchSize: 2,
+		DryRun:    true,
+	}
+	compactor := NewHistoryCompactor(dbConn)
+
+	result, err := compactor.Compact(ctx, opts)
+
+	require.NoError(t, err)
+	assert.Equal(t, &CompactResult{
+		DryRun:         true,
+		Keys:           3,
+		CompactedKeys:  3,
+		PrunedRecords:  5,
+		PrunedBlobs:    1,
+		PrunedByPolicy: map[string]int64{"": 3, "session.": 2},
+	}, result)
+	assert.Equal(t, int64(10), countRows(dbConn, &model.EventHistory{}))
+
+	opts.DryRun = false
+	result, err = compactor.Compact(ctx, opts)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), result.PrunedRecords)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "doc", UserId: userId}})
+	assert.Equal(t, []int64{2, 3}, sequencesOf(history))
+	history, _, _ = repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "session.a", UserId: userId}})
+	assert.Equal(t, []int64{3}, sequencesOf(history))
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "session.a", UserId: userId})
+	require.NoError(t, err)
+	assert.Equal(t, history[0].Version, snapshot.Version)
+	var blobs int64
+	dbConn.WithContext(ctx).Model(&model.EventBlob{}).Where("value = ?", document).Count(&blobs)
+	assert.Equal(t, int64(0), blobs)
+}
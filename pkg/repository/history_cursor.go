@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+)
+
+var ErrInvalidCursor = errors.New("invalid history cursor")
+
+// historyCursor points at the last record of a history page. It is handed
+// out base64 encoded so clients treat it as opaque.
+type historyCursor struct {
+	Sequence int64 `json:"sequence"`
+}
+
+func encodeHistoryCursor(last model.EventHistory) string {
+	b, _ := json.Marshal(historyCursor{Sequence: last.Sequence})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeHistoryCursor(cursor string) (*historyCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	var res historyCursor
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,459 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var errDuplicateKey = errors.New("duplicate key value violates unique constraint")
+
+type snapshotKey struct {
+	key    string
+	userId string
+}
+
+// memoryEventRepository keeps snapshots in a map and history in an append-only
+// slice. It mirrors the behaviour of gormEventRepository and is meant for local
+// development and tests, nothing survives a restart.
+type memoryEventRepository struct {
+	mu         sync.RWMutex
+	snapshots  map[snapshotKey]model.EventSnapshot
+	history    []model.EventHistory
+	sequences  map[snapshotKey]int64
+	lastOffset int64
+	now        func() time.Time
+}
+
+func (mer *memoryEventRepository) CreateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	_, err := mer.createKey(eventInfo, "")
+	return err
+}
+
+func (mer *memoryEventRepository) UpdateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	_, err := mer.updateKey(eventInfo, "")
+	return err
+}
+
+func (mer *memoryEventRepository) GetAnswer(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+	mer.mu.RLock()
+	defer mer.mu.RUnlock()
+
+	res, ok := mer.liveSnapshot(snapshotKey{key: eventQuery.Key, userId: eventQuery.UserId})
+	if !ok {
+		return nil, fmt.Errorf("get answer for: %s key for %s user failed: %w", eventQuery.Key, eventQuery.UserId, gorm.ErrRecordNotFound)
+	}
+
+	return &res, nil
+}
+
+func (mer *memoryEventRepository) GetAnswerAt(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*model.EventSnapshot, error) {
+	mer.mu.RLock()
+	defer mer.mu.RUnlock()
+
+	for i := len(mer.history) - 1; i >= 0; i-- {
+		record := mer.history[i]
+		if record.Key != eventQuery.Key || record.UserId != eventQuery.UserId || record.CreatedAt.After(at) {
+			continue
+		}
+
+		if record.RemovesKey() {
+			break
+		}
+
+		return &model.EventSnapshot{Key: record.Key, Value: record.Value, ValueType: record.ValueType, UserId: record.UserId, Version: record.Version}, nil
+	}
+
+	return nil, fmt.Errorf("get answer at %s for: %s key for %s user: %w", at.Format(time.RFC3339), eventQuery.Key, eventQuery.UserId, ErrKeyNotFound)
+}
+
+func (mer *memoryEventRepository) GetVersion(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error) {
+	mer.mu.RLock()
+	defer mer.mu.RUnlock()
+
+	for i := len(mer.history) - 1; i >= 0; i-- {
+		record := mer.history[i]
+		if record.Key == eventQuery.Key && record.UserId == eventQuery.UserId && record.Version == eventQuery.Version {
+			return &record, nil
+		}
+	}
+
+	return nil, fmt.Errorf("get version %d for: %s key for %s user: %w", eventQuery.Version, eventQuery.Key, eventQuery.UserId, ErrVersionNotFound)
+}
+
+func (mer *memoryEventRepository) ExpireKeys(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error) {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	var expired []model.EventSnapshot
+	for _, snapshot := range mer.snapshots {
+		if snapshot.ExpiredAt(now) {
+			expired = append(expired, snapshot)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].ExpiresAt.Before(*expired[j].ExpiresAt)
+	})
+	if limit > 0 && len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	res := make([]model.EventHistory, 0, len(expired))
+	for _, snapshot := range expired {
+		res = append(res, *mer.expireKey(snapshot))
+	}
+	return res, nil
+}
+
+func (mer *memoryEventRepository) DeleteKey(ctx context.Context, eventQuery *dto.EventQuery) error {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	_, err := mer.deleteKey(eventQuery, "")
+	return err
+}
+
+// ApplyBatch applies the operations in order and puts the repository back the
+// way it was when one of them fails.
+func (mer *memoryEventRepository) ApplyBatch(ctx context.Context, batchId string, operations []dto.BatchOperation) ([]model.EventHistory, error) {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	checkpoint := mer.checkpoint()
+	res := make([]model.EventHistory, 0, len(operations))
+	for i, operation := range operations {
+		record, err := mer.applyOperation(operation, batchId)
+		if err != nil {
+			mer.restore(checkpoint)
+			return nil, fmt.Errorf("batch %s operation %d failed: %w", batchId, i, err)
+		}
+		res = append(res, *record)
+	}
+
+	return res, nil
+}
+
+func (mer *memoryEventRepository) CompareAndSwap(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error) {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	sk := snapshotKey{key: eventInfo.Key, userId: eventInfo.UserId}
+	current, ok := mer.liveSnapshot(sk)
+	if !ok {
+		return nil, fmt.Errorf("compare and swap for: %s key for %s not found: %w", eventInfo.Key, eventInfo.UserId, ErrKeyNotFound)
+	}
+
+	if !current.Value.Equal(expected) {
+		return &current, fmt.Errorf("compare and swap for: %s key for %s user expected %s: %w", eventInfo.Key, eventInfo.UserId, expected, ErrValueMismatch)
+	}
+
+	current.Value = eventInfo.Value
+	current.ValueType = eventInfo.Value.Type()
+	current.Version++
+	mer.snapshots[sk] = current
+	mer.appendHistory(&current, model.UpdateAction, "")
+	return &current, nil
+}
+
+func (mer *memoryEventRepository) RestoreKey(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	sk := snapshotKey{key: eventQuery.Key, userId: eventQuery.UserId}
+	mer.expireStale(sk)
+	if _, ok := mer.snapshots[sk]; ok {
+		return nil, fmt.Errorf("restore key for: %s key for %s user: %w", eventQuery.Key, eventQuery.UserId, ErrKeyExists)
+	}
+
+	var last *model.EventHistory
+	for i := len(mer.history) - 1; i >= 0; i-- {
+		record := mer.history[i]
+		if record.Key != eventQuery.Key || record.UserId != eventQuery.UserId {
+			continue
+		}
+
+		if last == nil {
+			last = &record
+		}
+
+		if record.RemovesKey() {
+			continue
+		}
+
+		restored := model.EventSnapshot{Key: record.Key, Value: record.Value, ValueType: record.ValueType, UserId: record.UserId, Version: last.Version + 1}
+		mer.snapshots[sk] = restored
+		mer.appendHistory(&restored, model.RestoreAction, "")
+		return &restored, nil
+	}
+
+	return nil, fmt.Errorf("restore key for: %s key for %s user has no value to restore: %w", eventQuery.Key, eventQuery.UserId, ErrKeyNotFound)
+}
+
+func (mer *memoryEventRepository) RevertKey(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error) {
+	mer.mu.Lock()
+	defer mer.mu.Unlock()
+
+	var source *model.EventHistory
+	for i := len(mer.history) - 1; i >= 0 && source == nil; i-- {
+		record := mer.history[i]
+		if record.Key != revertQuery.Key || record.UserId != revertQuery.UserId {
+			continue
+		}
+
+		if revertQuery.Sequence != 0 && record.Sequence == revertQuery.Sequence ||
+			revertQuery.Sequence == 0 && !record.CreatedAt.After(revertQuery.At) {
+			source = &record
+		}
+	}
+
+	if source == nil || source.RemovesKey() {
+		return nil, fmt.Errorf("revert key for: %s key for %s user has no value to revert to: %w", revertQuery.Key, revertQuery.UserId, ErrVersionNotFound)
+	}
+
+	sk := snapshotKey{key: revertQuery.Key, userId: revertQuery.UserId}
+	current, ok := mer.liveSnapshot(sk)
+	if !ok {
+		return nil, fmt.Errorf("update key for: %s key for %s not found: %w", revertQuery.Key, revertQuery.UserId, ErrKeyNotFound)
+	}
+
+	if revertQuery.Version != 0 && revertQuery.Version != current.Version {
+		return nil, fmt.Errorf("update key for: %s key for %s user at version %d, current version %d: %w", revertQuery.Key, revertQuery.UserId, revertQuery.Version, current.Version, ErrVersionMismatch)
+	}
+
+	reverted := model.EventSnapshot{Key: revertQuery.Key, Value: source.Value, ValueType: source.ValueType, UserId: revertQuery.UserId, Version: current.Version + 1, ExpiresAt: current.ExpiresAt}
+	mer.snapshots[sk] = reverted
+	mer.appendHistory(&reverted, model.RevertAction, "")
+	mer.history[len(mer.history)-1].SourceVersion = source.Version
+	return &reverted, nil
+}
+
+func (mer *memoryEventRepository) GetHistory(ctx context.Context, historyQuery *dto.HistoryQuery) ([]model.EventHistory, string, error) {
+	var cursor *historyCursor
+	if historyQuery.Cursor != "" {
+		var err error
+		if cursor, err = decodeHistoryCursor(historyQuery.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	mer.mu.RLock()
+	defer mer.mu.RUnlock()
+
+	var res []model.EventHistory
+	for i := range mer.history {
+		record := mer.history[i]
+		if historyQuery.Descending {
+			record = mer.history[len(mer.history)-1-i]
+		}
+
+		if matchesHistoryQuery(record, historyQuery, cursor) {
+			res = append(res, record)
+		}
+	}
+
+	if historyQuery.Limit <= 0 || len(res) <= historyQuery.Limit {
+		return res, "", nil
+	}
+
+	res = res[:historyQuery.Limit]
+	return res, encodeHistoryCursor(res[len(res)-1]), nil
+}
+
+func (mer *memoryEventRepository) applyOperation(operation dto.BatchOperation, batchId string) (*model.EventHistory, error) {
+	switch operation.Action {
+	case model.CreateAction:
+		return mer.createKey(&model.EventSnapshot{Key: operation.Key, Value: operation.Value, UserId: operation.UserId}, batchId)
+	case model.UpdateAction:
+		return mer.updateKey(&model.EventSnapshot{Key: operation.Key, Value: operation.Value, UserId: operation.UserId, Version: operation.Version}, batchId)
+	case model.DeleteAction:
+		return mer.deleteKey(&dto.EventQuery{Key: operation.Key, UserId: operation.UserId, Version: operation.Version}, batchId)
+	}
+
+	return nil, fmt.Errorf("unknown batch action %q for %s/%s", operation.Action, operation.Key, operation.UserId)
+}
+
+func (mer *memoryEventRepository) createKey(eventInfo *model.EventSnapshot, batchId string) (*model.EventHistory, error) {
+	sk := snapshotKey{key: eventInfo.Key, userId: eventInfo.UserId}
+	mer.expireStale(sk)
+	if _, ok := mer.snapshots[sk]; ok {
+		return nil, fmt.Errorf("create key for: %s key for %s user failed. error %w", eventInfo.Key, eventInfo.UserId, errDuplicateKey)
+	}
+
+	eventInfo.Version = mer.lastVersion(sk) + 1
+	eventInfo.ValueType = eventInfo.Value.Type()
+	mer.snapshots[sk] = *eventInfo
+	return mer.appendHistory(eventInfo, model.CreateAction, batchId), nil
+}
+
+func (mer *memoryEventRepository) updateKey(eventInfo *model.EventSnapshot, batchId string) (*model.EventHistory, error) {
+	sk := snapshotKey{key: eventInfo.Key, userId: eventInfo.UserId}
+	current, ok := mer.liveSnapshot(sk)
+	if !ok {
+		return nil, fmt.Errorf("update key for: %s key for %s not found: %w", eventInfo.Key, eventInfo.UserId, ErrKeyNotFound)
+	}
+
+	if eventInfo.Version != 0 && eventInfo.Version != current.Version {
+		return nil, fmt.Errorf("update key for: %s key for %s user at version %d, current version %d: %w", eventInfo.Key, eventInfo.UserId, eventInfo.Version, current.Version, ErrVersionMismatch)
+	}
+
+	if eventInfo.ExpiresAt == nil {
+		eventInfo.ExpiresAt = current.ExpiresAt
+	}
+
+	eventInfo.Version = current.Version + 1
+	eventInfo.ValueType = eventInfo.Value.Type()
+	mer.snapshots[sk] = *eventInfo
+	return mer.appendHistory(eventInfo, model.UpdateAction, batchId), nil
+}
+
+func (mer *memoryEventRepository) deleteKey(eventQuery *dto.EventQuery, batchId string) (*model.EventHistory, error) {
+	sk := snapshotKey{key: eventQuery.Key, userId: eventQuery.UserId}
+	current, ok := mer.liveSnapshot(sk)
+	if !ok {
+		return nil, fmt.Errorf("record not found for %s key %s user: %w", eventQuery.Key, eventQuery.UserId, ErrKeyNotFound)
+	}
+
+	if eventQuery.Version != 0 && eventQuery.Version != current.Version {
+		return nil, fmt.Errorf("delete key for: %s key for %s user at version %d, current version %d: %w", eventQuery.Key, eventQuery.UserId, eventQuery.Version, current.Version, ErrVersionMismatch)
+	}
+
+	delete(mer.snapshots, sk)
+	deleted := &model.EventSnapshot{Key: eventQuery.Key, UserId: eventQuery.UserId, Version: current.Version + 1}
+	return mer.appendHistory(deleted, model.DeleteAction, batchId), nil
+}
+
+// liveSnapshot returns the snapshot of a key unless it has expired.
+func (mer *memoryEventRepository) liveSnapshot(sk snapshotKey) (model.EventSnapshot, bool) {
+	snapshot, ok := mer.snapshots[sk]
+	if !ok || snapshot.ExpiredAt(mer.now()) {
+		return model.EventSnapshot{}, false
+	}
+	return snapshot, true
+}
+
+// expireStale expires the snapshot of a key that has expired but has not been
+// reaped yet, so that the key can be written again.
+func (mer *memoryEventRepository) expireStale(sk snapshotKey) {
+	if snapshot, ok := mer.snapshots[sk]; ok && snapshot.ExpiredAt(mer.now()) {
+		mer.expireKey(snapshot)
+	}
+}
+
+func (mer *memoryEventRepository) expireKey(snapshot model.EventSnapshot) *model.EventHistory {
+	delete(mer.snapshots, snapshotKey{key: snapshot.Key, userId: snapshot.UserId})
+	expired := &model.EventSnapshot{Key: snapshot.Key, UserId: snapshot.UserId, Version: snapshot.Version + 1}
+	return mer.appendHistory(expired, model.ExpireAction, "")
+}
+
+// lastVersion is the version of the last history record of a key, zero when it has none.
+func (mer *memoryEventRepository) lastVersion(sk snapshotKey) int64 {
+	for i := len(mer.history) - 1; i >= 0; i-- {
+		if record := mer.history[i]; record.Key == sk.key && record.UserId == sk.userId {
+			return record.Version
+		}
+	}
+	return 0
+}
+
+func (mer *memoryEventRepository) appendHistory(eventInfo *model.EventSnapshot, action, batchId string) *model.EventHistory {
+	sk := snapshotKey{key: eventInfo.Key, userId: eventInfo.UserId}
+	mer.sequences[sk]++
+	mer.lastOffset++
+
+	record := model.NewHistoryRecord(eventInfo, action)
+	record.CreatedAt = mer.now()
+	record.Sequence = mer.sequences[sk]
+	record.Offset = mer.lastOffset
+	record.BatchId = batchId
+	mer.history = append(mer.history, *record)
+	return record
+}
+
+// memoryCheckpoint is what a failed batch has to put back. History is append
+// only, so remembering its length is enough.
+type memoryCheckpoint struct {
+	snapshots  map[snapshotKey]model.EventSnapshot
+	sequences  map[snapshotKey]int64
+	history    int
+	lastOffset int64
+}
+
+func (mer *memoryEventRepository) checkpoint() memoryCheckpoint {
+	cp := memoryCheckpoint{
+		snapshots:  make(map[snapshotKey]model.EventSnapshot, len(mer.snapshots)),
+		sequences:  make(map[snapshotKey]int64, len(mer.sequences)),
+		history:    len(mer.history),
+		lastOffset: mer.lastOffset,
+	}
+	for sk, snapshot := range mer.snapshots {
+		cp.snapshots[sk] = snapshot
+	}
+	for sk, sequence := range mer.sequences {
+		cp.sequences[sk] = sequence
+	}
+	return cp
+}
+
+func (mer *memoryEventRepository) restore(cp memoryCheckpoint) {
+	mer.snapshots = cp.snapshots
+	mer.sequences = cp.sequences
+	mer.history = mer.history[:cp.history]
+	mer.lastOffset = cp.lastOffset
+}
+
+func matchesHistoryQuery(record model.EventHistory, historyQuery *dto.HistoryQuery, cursor *historyCursor) bool {
+	if record.Key != historyQuery.Key || record.UserId != historyQuery.UserId {
+		return false
+	}
+
+	if !historyQuery.From.IsZero() && record.CreatedAt.Before(historyQuery.From) {
+		return false
+	}
+
+	if !historyQuery.To.IsZero() && !record.CreatedAt.Before(historyQuery.To) {
+		return false
+	}
+
+	if len(historyQuery.Actions) > 0 && !containsAction(historyQuery.Actions, record.Action) {
+		return false
+	}
+
+	if cursor == nil {
+		return true
+	}
+
+	if historyQuery.Descending {
+		return record.Sequence < cursor.Sequence
+	}
+	return record.Sequence > cursor.Sequence
+}
+
+func containsAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func NewMemoryEventRepository() EventRepository {
+	return &memoryEventRepository{
+		snapshots: map[snapshotKey]model.EventSnapshot{},
+		sequences: map[snapshotKey]int64{},
+		now:       time.Now,
+	}
+}
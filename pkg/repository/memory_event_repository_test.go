@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryEventRepository_CreateKey(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	createEvent := &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}
+
+	require.NoError(t, repository.CreateKey(ctx, createEvent))
+	err := repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId})
+
+	assert.Contains(t, err.Error(), "duplicate key value violates unique constraint")
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+	assert.NoError(t, err)
+	assert.Equal(t, createEvent, snapshot)
+}
+
+func TestMemoryEventRepository_UpdateKey_fails(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+
+	err := repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId})
+
+	assert.Contains(t, err.Error(), "not found")
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+	assert.Empty(t, history)
+}
+
+func TestMemoryEventRepository_DeleteKey(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	query := &dto.EventQuery{Key: "name", UserId: userId}
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+
+	require.NoError(t, repository.DeleteKey(ctx, query))
+
+	_, err := repository.GetAnswer(ctx, query)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	assert.Contains(t, repository.DeleteKey(ctx, query).Error(), "record not found")
+}
+
+func TestMemoryEventRepository_UpdateKey_versioned(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	updateEvent := &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId, Version: 1}
+
+	require.NoError(t, repository.UpdateKey(ctx, updateEvent))
+
+	assert.Equal(t, int64(2), updateEvent.Version)
+	err := repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"tom"`, UserId: userId, Version: 1})
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+	err = repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId, Version: 1})
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+	require.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId, Version: 2}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"ann"`, UserId: userId}))
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+	assert.Equal(t, []int64{1, 2, 3, 4}, versionsOf(history))
+	assert.Equal(t, []int64{1, 2, 3, 4}, sequencesOf(history))
+}
+
+func TestMemoryEventRepository_GetHistory(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	query := &dto.EventQuery{Key: "name", UserId: userId}
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"tom"`, UserId: userId}))
+	require.NoError(t, repository.DeleteKey(ctx, query))
+	historyQuery := &dto.HistoryQuery{
+		EventQuery: *query,
+		Actions:    []string{model.UpdateAction, model.DeleteAction},
+		Descending: true,
+		Limit:      2,
+	}
+
+	firstPage, cursor, err := repository.GetHistory(ctx, historyQuery)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{model.DeleteAction, model.UpdateAction}, actionsOf(firstPage))
+	assert.Equal(t, model.JSONValue(`"tom"`), firstPage[1].Value)
+
+	historyQuery.Cursor = cursor
+	secondPage, cursor, err := repository.GetHistory(ctx, historyQuery)
+
+	assert.NoError(t, err)
+	assert.Empty(t, cursor)
+	assert.Equal(t, 1, len(secondPage))
+	assert.Equal(t, model.JSONValue(`"sam"`), secondPage[0].Value)
+}
+
+func TestMemoryEventRepository_GetAnswerAt(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	repository := &memoryEventRepository{
+		snapshots: map[snapshotKey]model.EventSnapshot{},
+		sequences: map[snapshotKey]int64{},
+		now:       func() time.Time { return clock },
+	}
+	query := &dto.EventQuery{Key: "name", UserId: userId}
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	clock = clock.Add(time.Hour)
+	require.NoError(t, repository.DeleteKey(ctx, query))
+
+	snapshot, err := repository.GetAnswerAt(ctx, query, clock.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, model.JSONValue(`"john"`), snapshot.Value)
+
+	_, err = repository.GetAnswerAt(ctx, query, clock)
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestMemoryEventRepository_concurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = repository.CreateKey(ctx, &model.EventSnapshot{Key: fmt.Sprintf("key-%d", i), Value: `"v"`, UserId: userId})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 50; i++ {
+		history, _, err := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: fmt.Sprintf("key-%d", i), UserId: userId}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(history))
+	}
+}
+
+func TestMemoryEventRepository_ApplyBatch_allOrNothing(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "city", Value: `"pune"`, UserId: userId}))
+
+	history, err := repository.ApplyBatch(ctx, "batch-1", []dto.BatchOperation{
+		{Action: model.CreateAction, Key: "name", Value: `"john"`, UserId: userId},
+		{Action: model.DeleteAction, Key: "city", UserId: userId},
+		{Action: model.DeleteAction, Key: "zip", UserId: userId},
+	})
+
+	assert.Nil(t, history)
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+	_, err = repository.GetAnswer(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+	assert.Error(t, err)
+	snapshot, err := repository.GetAnswer(ctx, &dto.EventQuery{Key: "city", UserId: userId})
+	require.NoError(t, err)
+	assert.Equal(t, model.JSONValue(`"pune"`), snapshot.Value)
+
+	history, err = repository.ApplyBatch(ctx, "batch-2", []dto.BatchOperation{
+		{Action: model.CreateAction, Key: "name", Value: `"john"`, UserId: userId},
+		{Action: model.UpdateAction, Key: "city", Value: `"mumbai"`, UserId: userId, Version: 1},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"batch-2", "batch-2"}, []string{history[0].BatchId, history[1].BatchId})
+	assert.Equal(t, []int64{2, 3}, []int64{history[0].Offset, history[1].Offset})
+	cityHistory, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "city", UserId: userId}})
+	assert.Equal(t, []string{model.CreateAction, model.UpdateAction}, actionsOf(cityHistory))
+}
+
+func TestMemoryEventRepository_CompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "state", Value: `"open"`, UserId: userId}))
+
+	current, err := repository.CompareAndSwap(ctx, &model.EventSnapshot{Key: "state", Value: `"reopened"`, UserId: userId}, `"closed"`)
+
+	assert.True(t, errors.Is(err, ErrValueMismatch))
+	assert.Equal(t, model.JSONValue(`"open"`), current.Value)
+
+	swapped, err := repository.CompareAndSwap(ctx, &model.EventSnapshot{Key: "state", Value: `"closed"`, UserId: userId}, `"open"`)
+
+	require.NoError(t, err)
+	assert.Equal(t, &model.EventSnapshot{Key: "state", Value: `"closed"`, ValueType: model.StringValue, UserId: userId, Version: 2}, swapped)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "state", UserId: userId}})
+	assert.Equal(t, []string{model.CreateAction, model.UpdateAction}, actionsOf(history))
+}
+
+func TestMemoryEventRepository_RestoreKey(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemoryEventRepository()
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "name", UserId: userId}))
+
+	restored, err := repository.RestoreKey(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+
+	require.NoError(t, err)
+	assert.Equal(t, &model.EventSnapshot{Key: "name", Value: `"john"`, ValueType: model.StringValue, UserId: userId, Version: 3}, restored)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+	assert.Equal(t, []string{model.CreateAction, model.DeleteAction, model.RestoreAction}, actionsOf(history))
+
+	_, err = repository.RestoreKey(ctx, &dto.EventQuery{Key: "name", UserId: userId})
+
+	assert.True(t, errors.Is(err, ErrKeyExists))
+}
+
+func TestMemoryEventRepository_RevertKey(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	repository := &memoryEventRepository{
+		snapshots: map[snapshotKey]model.EventSnapshot{},
+		sequences: map[snapshotKey]int64{},
+		now:       func() time.Time { return clock },
+	}
+	query := dto.EventQuery{Key: "name", UserId: userId}
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	clock = clock.Add(time.Hour)
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"jane"`, UserId: userId}))
+	clock = clock.Add(time.Hour)
+	require.NoError(t, repository.DeleteKey(ctx, &query))
+
+	_, err := repository.RevertKey(ctx, &dto.RevertQuery{EventQuery: query, At: clock})
+
+	assert.True(t, errors.Is(err, ErrVersionNotFound))
+
+	_, err = repository.RestoreKey(ctx, &query)
+	require.NoError(t, err)
+
+	reverted, err := repository.RevertKey(ctx, &dto.RevertQuery{EventQuery: query, At: clock.Add(-90 * time.Minute)})
+
+	require.NoError(t, err)
+	assert.Equal(t, &model.EventSnapshot{Key: "name", Value: `"john"`, ValueType: model.StringValue, UserId: userId, Version: 5}, reverted)
+	history, _, _ := repository.GetHistory(ctx, &dto.HistoryQuery{EventQuery: query})
+	assert.Equal(t, model.RevertAction, history[4].Action)
+	assert.Equal(t, int64(1), history[4].SourceVersion)
+}
+
+func TestMemoryEventRepository_ExpireKeys(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	repository := &memoryEventRepository{
+		snapshots: map[snapshotKey]model.EventSnapshot{},
+		sequences: map[snapshotKey]int64{},
+		now:       func() time.Time { return clock },
+	}
+	query := dto.EventQuery{Key: "session", UserId: userId}
+	expiresAt := clock.Add(time.Minute)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "session", Value: `"abc"`, UserId: userId, ExpiresAt: &expiresAt}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "session", Value: `"def"`, UserId: userId}))
+
+	snapshot, err := repository.GetAnswer(ctx, &query)
+	require.NoError(t, err)
+	assert.Equal(t, &expiresAt, snapshot.ExpiresAt)
+
+	clock = clock.Add(time.Hour)
+	_, err = repository.GetAnswer(ctx, &query)
+	assert.Error(t, err)
+
+	records, err := repository.ExpireKeys(ctx, clock, 10)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{model.ExpireAction}, actionsOf(records))
+	assert.Equal(t, int64(3), records[0].Version)
+	restored, err := repository.RestoreKey(ctx, &query)
+	require.NoError(t, err)
+	assert.Equal(t, model.JSONValue(`"def"`), restored.Value)
+	assert.Nil(t, restored.ExpiresAt)
+}
+
+func actionsOf(history []model.EventHistory) []string {
+	var actions []string
+	for _, record := range history {
+		actions = append(actions, record.Action)
+	}
+	return actions
+}
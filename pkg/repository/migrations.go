@@ -1,83 +1,194 @@
 package repository
 
 import (
+	"embed"
+	"errors"
+	"event-history/pkg/config"
 	"fmt"
+	"net/http"
+	"os"
+	"path"
 	"path/filepath"
-	"event-history/pkg/config"
 	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
 )
 
 const (
 	rollBackStep = -1
 	cutSet       = "file://"
-	databaseName = "postgres"
 )
 
-func RunMigrations(configFile string) {
-	newMigrate, err := newMigrate(configFile)
+// migrationFiles holds a migration set per driver, in a sub directory named
+// after it.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// MigrationStatus is the version a database is migrated to, zero when no
+// migration was applied yet. Dirty is set when a migration failed halfway and
+// the database has to be fixed and forced to a version before migrating on.
+type MigrationStatus struct {
+	Version uint   `json:"version"`
+	Dirty   bool   `json:"dirty"`
+	Latest  uint   `json:"latest"`
+	Pending []uint `json:"pending"`
+}
+
+// RunMigrations applies every pending migration.
+func RunMigrations(dbConfig config.DBConfig) error {
+	return withMigrate(dbConfig, func(m *migrate.Migrate, _ source.Driver) error {
+		return ignoreNoChange(m.Up())
+	})
+}
+
+// RollBackMigrations reverts the last applied migration, if there is one.
+func RollBackMigrations(dbConfig config.DBConfig) error {
+	return withMigrate(dbConfig, func(m *migrate.Migrate, _ source.Driver) error {
+		if _, _, err := m.Version(); errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+		return ignoreNoChange(m.Steps(rollBackStep))
+	})
+}
+
+// MigrateTo applies or reverts migrations until the database is at version.
+// Version 0 is no migration of the set, it reverts every migration instead.
+func MigrateTo(dbConfig config.DBConfig, version uint) error {
+	return withMigrate(dbConfig, func(m *migrate.Migrate, _ source.Driver) error {
+		if version == 0 {
+			return ignoreNoChange(m.Down())
+		}
+		return ignoreNoChange(m.Migrate(version))
+	})
+}
+
+// ForceMigration sets the version of the database and clears its dirty flag
+// without running any migration, -1 marks it as not migrated at all.
+func ForceMigration(dbConfig config.DBConfig, version int) error {
+	return withMigrate(dbConfig, func(m *migrate.Migrate, _ source.Driver) error {
+		return m.Force(version)
+	})
+}
+
+// GetMigrationStatus reports the version of the database and the migrations
+// that are not applied yet.
+func GetMigrationStatus(dbConfig config.DBConfig) (*MigrationStatus, error) {
+	status := &MigrationStatus{Pending: []uint{}}
+	err := withMigrate(dbConfig, func(m *migrate.Migrate, src source.Driver) error {
+		version, dirty, err := m.Version()
+		if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+			return err
+		}
+		status.Version, status.Dirty = version, dirty
+
+		for next, err := src.First(); ; next, err = src.Next(next) {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			status.Latest = next
+			if next > status.Version {
+				status.Pending = append(status.Pending, next)
+			}
+		}
+	})
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, err
 	}
+	return status, nil
+}
 
-	if err := newMigrate.Up(); err != nil {
-		if err == migrate.ErrNoChange {
-			return
-		}
-		fmt.Println(err)
-		return
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
 	}
+	return err
 }
 
-func RollBackMigrations(configFile string) {
-	newMigrate, err := newMigrate(configFile)
+// withMigrate runs fn with a migrate instance for the database of dbConfig and
+// closes the instance, along with its connection, afterwards.
+func withMigrate(dbConfig config.DBConfig, fn func(m *migrate.Migrate, src source.Driver) error) error {
+	m, src, err := newMigrate(dbConfig)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
-	if err := newMigrate.Steps(rollBackStep); err != nil {
-		if err == migrate.ErrNoChange {
-			return
+	err = fn(m, src)
+	if srcErr, dbErr := m.Close(); err == nil {
+		if srcErr != nil {
+			return srcErr
 		}
+		return dbErr
 	}
+	return err
 }
 
-func newMigrate(configFile string) (*migrate.Migrate, error) {
-	cfg := config.NewConfig(configFile)
-	dbConfig := cfg.GetDBConfig()
-
+func newMigrate(dbConfig config.DBConfig) (*migrate.Migrate, source.Driver, error) {
 	dbHandler := NewDBHandler(dbConfig)
 
 	gormDB, err := dbHandler.GetDB()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	db, err := gormDB.DB()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	driver, err := mysql.WithInstance(db, &mysql.Config{})
+	var driver database.Driver
+	switch dbConfig.Driver() {
+	case config.SQLiteDriver:
+		driver, err = sqlite3.WithInstance(db, &sqlite3.Config{})
+	case config.MySQLDriver:
+		driver, err = mysql.WithInstance(db, &mysql.Config{})
+	default:
+		driver, err = postgres.WithInstance(db, &postgres.Config{})
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	sourcePath, err := getSourcePath(dbConfig.MigrationPath())
+	src, err := migrationSource(dbConfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return migrate.NewWithDatabaseInstance(sourcePath, databaseName, driver)
+	m, err := migrate.NewWithInstance("migrations", src, dbConfig.Driver(), driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, src, nil
+}
+
+// migrationSource reads the migration set of the driver from the binary, or
+// from MIGRATION_PATH on disk when it is set, which is handy while writing a
+// new migration.
+func migrationSource(dbConfig config.DBConfig) (source.Driver, error) {
+	if dbConfig.MigrationPath() == "" {
+		return httpfs.New(http.FS(migrationFiles), path.Join("migrations", dbConfig.Driver()))
+	}
+
+	sourcePath, err := getSourcePath(filepath.Join(dbConfig.MigrationPath(), dbConfig.Driver()))
+	if err != nil {
+		return nil, err
+	}
+	return source.Open(sourcePath)
 }
 
 func getSourcePath(directory string) (string, error) {
-	directory = strings.TrimLeft(directory, cutSet)
+	directory = strings.TrimPrefix(directory, cutSet)
 
 	absPath, err := filepath.Abs(directory)
 	if err != nil {
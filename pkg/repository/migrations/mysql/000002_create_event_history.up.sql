@@ -0,0 +1,7 @@
+create table if not exists event_history (
+    `key` varchar(100),
+    value varchar(100),
+    user_id varchar(100),
+    action varchar(100),
+    created_at timestamp(6) NULL DEFAULT CURRENT_TIMESTAMP(6)
+    );
@@ -0,0 +1,2 @@
+alter table event_history drop column version;
+alter table event_snapshot drop column version;
@@ -0,0 +1,2 @@
+alter table event_snapshot add column version bigint not null default 1;
+alter table event_history add column version bigint not null default 1;
@@ -0,0 +1,3 @@
+drop index event_history_key_sequence on event_history;
+alter table event_history drop column sequence;
+alter table event_history drop column event_offset;
@@ -0,0 +1,12 @@
+alter table event_history add column event_offset bigint not null auto_increment unique;
+alter table event_history add column sequence bigint not null default 0;
+
+update event_history h
+join (
+    select event_offset,
+           row_number() over (partition by user_id, `key` order by created_at, event_offset) as sequence
+    from event_history
+    ) o on h.event_offset = o.event_offset
+set h.sequence = o.sequence;
+
+create unique index event_history_key_sequence on event_history (user_id, `key`, sequence);
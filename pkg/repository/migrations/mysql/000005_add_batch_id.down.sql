@@ -0,0 +1,2 @@
+drop index event_history_batch_id on event_history;
+alter table event_history drop column batch_id;
@@ -0,0 +1,10 @@
+-- Values that are not JSON strings come back as their JSON text, cut at 100 characters.
+alter table event_snapshot add column value_text varchar(100);
+update event_snapshot set value_text = left(value ->> '$', 100) where value is not null;
+alter table event_snapshot drop column value, drop column value_type;
+alter table event_snapshot rename column value_text to value;
+
+alter table event_history add column value_text varchar(100);
+update event_history set value_text = left(value ->> '$', 100) where value is not null;
+alter table event_history drop column value, drop column value_type;
+alter table event_history rename column value_text to value;
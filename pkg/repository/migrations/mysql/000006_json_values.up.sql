@@ -0,0 +1,9 @@
+alter table event_snapshot add column value_json json, add column value_type varchar(10);
+update event_snapshot set value_json = json_quote(value), value_type = 'string' where value is not null;
+alter table event_snapshot drop column value;
+alter table event_snapshot rename column value_json to value;
+
+alter table event_history add column value_json json, add column value_type varchar(10);
+update event_history set value_json = json_quote(value), value_type = 'string' where value is not null and action <> 'delete';
+alter table event_history drop column value;
+alter table event_history rename column value_json to value;
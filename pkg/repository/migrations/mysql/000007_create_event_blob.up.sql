@@ -0,0 +1,12 @@
+create table if not exists event_blob (
+    hash varchar(64) primary key,
+    value json not null,
+    size bigint not null,
+    created_at timestamp(6) NULL DEFAULT CURRENT_TIMESTAMP(6)
+    );
+
+alter table event_snapshot add column blob_hash varchar(64);
+alter table event_history add column blob_hash varchar(64);
+
+create index event_snapshot_blob_hash on event_snapshot (blob_hash);
+create index event_history_blob_hash on event_history (blob_hash);
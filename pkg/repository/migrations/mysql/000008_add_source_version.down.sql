@@ -0,0 +1 @@
+alter table event_history drop column source_version;
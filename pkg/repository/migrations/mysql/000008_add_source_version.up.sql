@@ -0,0 +1 @@
+alter table event_history add column source_version bigint;
@@ -0,0 +1,2 @@
+alter table event_history drop column if exists version;
+alter table event_snapshot drop column if exists version;
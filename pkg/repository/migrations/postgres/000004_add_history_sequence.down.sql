@@ -0,0 +1,5 @@
+drop index if exists event_history_key_sequence;
+drop index if exists event_history_event_offset;
+alter table event_history drop column if exists sequence;
+alter table event_history drop column if exists event_offset;
+drop sequence if exists event_history_event_offset_seq;
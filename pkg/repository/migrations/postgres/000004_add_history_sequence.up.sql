@@ -0,0 +1,24 @@
+create sequence if not exists event_history_event_offset_seq;
+
+alter table event_history add column event_offset bigint;
+alter table event_history add column sequence bigint;
+
+update event_history h
+set event_offset = o.event_offset, sequence = o.sequence
+from (
+    select ctid,
+           row_number() over (order by created_at) as event_offset,
+           row_number() over (partition by user_id, key order by created_at) as sequence
+    from event_history
+    ) o
+where h.ctid = o.ctid;
+
+select setval('event_history_event_offset_seq', coalesce((select max(event_offset) from event_history), 0) + 1, false);
+
+alter table event_history alter column event_offset set default nextval('event_history_event_offset_seq');
+alter table event_history alter column event_offset set not null;
+alter table event_history alter column sequence set not null;
+alter sequence event_history_event_offset_seq owned by event_history.event_offset;
+
+create unique index if not exists event_history_event_offset on event_history (event_offset);
+create unique index if not exists event_history_key_sequence on event_history (user_id, key, sequence);
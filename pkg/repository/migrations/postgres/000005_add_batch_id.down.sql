@@ -0,0 +1,2 @@
+drop index if exists event_history_batch_id;
+alter table event_history drop column if exists batch_id;
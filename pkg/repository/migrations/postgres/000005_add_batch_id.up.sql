@@ -0,0 +1,3 @@
+alter table event_history add column if not exists batch_id varchar(36);
+
+create index if not exists event_history_batch_id on event_history (batch_id);
@@ -0,0 +1,16 @@
+-- Values that are not JSON strings come back as their JSON text, cut at 100 characters.
+do $$
+begin
+    if exists (select 1 from information_schema.columns
+               where table_name = 'event_snapshot' and column_name = 'value' and data_type = 'jsonb') then
+        alter table event_snapshot alter column value type varchar(100) using (value #>> '{}')::varchar(100);
+    end if;
+
+    if exists (select 1 from information_schema.columns
+               where table_name = 'event_history' and column_name = 'value' and data_type = 'jsonb') then
+        alter table event_history alter column value type varchar(100) using (value #>> '{}')::varchar(100);
+    end if;
+end $$;
+
+alter table event_snapshot drop column if exists value_type;
+alter table event_history drop column if exists value_type;
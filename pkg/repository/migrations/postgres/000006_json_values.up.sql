@@ -0,0 +1,7 @@
+alter table event_snapshot alter column value type jsonb using to_jsonb(value);
+alter table event_snapshot add column if not exists value_type varchar(10);
+update event_snapshot set value_type = 'string' where value is not null;
+
+alter table event_history alter column value type jsonb using case when action = 'delete' then null else to_jsonb(value) end;
+alter table event_history add column if not exists value_type varchar(10);
+update event_history set value_type = 'string' where value is not null;
@@ -0,0 +1,7 @@
+drop index if exists event_history_blob_hash;
+drop index if exists event_snapshot_blob_hash;
+
+alter table event_history drop column if exists blob_hash;
+alter table event_snapshot drop column if exists blob_hash;
+
+drop table if exists event_blob;
@@ -0,0 +1,12 @@
+create table if not exists event_blob (
+    hash varchar(64) primary key,
+    value jsonb not null,
+    size bigint not null,
+    created_at timestamp default current_timestamp
+    );
+
+alter table event_snapshot add column if not exists blob_hash varchar(64);
+alter table event_history add column if not exists blob_hash varchar(64);
+
+create index if not exists event_snapshot_blob_hash on event_snapshot (blob_hash);
+create index if not exists event_history_blob_hash on event_history (blob_hash);
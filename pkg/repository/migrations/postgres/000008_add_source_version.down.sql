@@ -0,0 +1 @@
+alter table event_history drop column if exists source_version;
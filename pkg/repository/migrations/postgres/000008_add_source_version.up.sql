@@ -0,0 +1 @@
+alter table event_history add column if not exists source_version bigint;
@@ -0,0 +1,3 @@
+drop index if exists event_snapshot_expires_at;
+alter table event_history drop column if exists expires_at;
+alter table event_snapshot drop column if exists expires_at;
@@ -0,0 +1,34 @@
+-- partitions detached by the partitions command are left alone, their rows do not come back
+alter table event_history rename to event_history_partitioned;
+alter sequence event_history_event_offset_seq owned by none;
+
+create table event_history (
+    key varchar(100),
+    value jsonb,
+    user_id varchar(100),
+    action varchar(100),
+    created_at timestamp default current_timestamp,
+    version bigint not null default 1,
+    event_offset bigint not null default nextval('event_history_event_offset_seq'),
+    sequence bigint not null,
+    batch_id varchar(36),
+    value_type varchar(10),
+    blob_hash varchar(64),
+    source_version bigint,
+    expires_at timestamp
+    );
+
+alter sequence event_history_event_offset_seq owned by event_history.event_offset;
+
+insert into event_history (key, value, user_id, action, created_at, version, event_offset, sequence, batch_id,
+                           value_type, blob_hash, source_version, expires_at)
+select key, value, user_id, action, created_at, version, event_offset, sequence, batch_id,
+       value_type, blob_hash, source_version, expires_at
+from event_history_partitioned;
+
+drop table event_history_partitioned;
+
+create unique index if not exists event_history_event_offset on event_history (event_offset);
+create unique index if not exists event_history_key_sequence on event_history (user_id, key, sequence);
+create index if not exists event_history_batch_id on event_history (batch_id);
+create index if not exists event_history_blob_hash on event_history (blob_hash);
@@ -0,0 +1,52 @@
+-- event_history becomes range partitioned by the month of created_at. A unique index of a partitioned table has
+-- to include created_at, so event_offset and (user_id, key, sequence) are indexed without being unique: offsets
+-- come from a sequence and the repository takes an advisory lock on the history of a key before it picks the
+-- next sequence of the key.
+alter table event_history rename to event_history_unpartitioned;
+alter sequence event_history_event_offset_seq owned by none;
+
+create table event_history (
+    key varchar(100),
+    value jsonb,
+    user_id varchar(100),
+    action varchar(100),
+    created_at timestamp not null default current_timestamp,
+    version bigint not null default 1,
+    event_offset bigint not null default nextval('event_history_event_offset_seq'),
+    sequence bigint not null,
+    batch_id varchar(36),
+    value_type varchar(10),
+    blob_hash varchar(64),
+    source_version bigint,
+    expires_at timestamp
+    ) partition by range (created_at);
+
+alter sequence event_history_event_offset_seq owned by event_history.event_offset;
+
+-- catches the rows of months no partition has been created for yet
+create table if not exists event_history_default partition of event_history default;
+
+do $$
+declare
+    lower_bound timestamp := date_trunc('month', coalesce((select min(created_at) from event_history_unpartitioned), current_timestamp));
+begin
+    while lower_bound < date_trunc('month', current_timestamp) + interval '4 months' loop
+        execute format('create table if not exists %I partition of event_history for values from (%L) to (%L)',
+                       'event_history_' || to_char(lower_bound, 'YYYY_MM'), lower_bound, lower_bound + interval '1 month');
+        lower_bound := lower_bound + interval '1 month';
+    end loop;
+end $$;
+
+insert into event_history (key, value, user_id, action, created_at, version, event_offset, sequence, batch_id,
+                           value_type, blob_hash, source_version, expires_at)
+select key, value, user_id, action, coalesce(created_at, current_timestamp), version, event_offset, sequence, batch_id,
+       value_type, blob_hash, source_version, expires_at
+from event_history_unpartitioned;
+
+drop table event_history_unpartitioned;
+
+create index if not exists event_history_user_key_created_at on event_history (user_id, key, created_at);
+create index if not exists event_history_key_sequence on event_history (user_id, key, sequence);
+create index if not exists event_history_event_offset on event_history (event_offset);
+create index if not exists event_history_batch_id on event_history (batch_id);
+create index if not exists event_history_blob_hash on event_history (blob_hash);
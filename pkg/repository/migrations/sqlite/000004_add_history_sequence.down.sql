@@ -0,0 +1,16 @@
+create table event_history_unsequenced (
+    key varchar(100),
+    value varchar(100),
+    user_id varchar(100),
+    action varchar(100),
+    created_at timestamp DEFAULT CURRENT_TIMESTAMP,
+    version bigint not null default 1
+    );
+
+insert into event_history_unsequenced (key, value, user_id, action, created_at, version)
+select key, value, user_id, action, created_at, version
+from event_history
+order by event_offset;
+
+drop table event_history;
+alter table event_history_unsequenced rename to event_history;
@@ -0,0 +1,21 @@
+create table event_history_sequenced (
+    event_offset integer primary key autoincrement,
+    key varchar(100),
+    value varchar(100),
+    user_id varchar(100),
+    action varchar(100),
+    created_at timestamp DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    version bigint not null default 1,
+    sequence bigint not null
+    );
+
+insert into event_history_sequenced (key, value, user_id, action, created_at, version, sequence)
+select key, value, user_id, action, created_at, version,
+       row_number() over (partition by user_id, key order by created_at, rowid)
+from event_history
+order by created_at, rowid;
+
+drop table event_history;
+alter table event_history_sequenced rename to event_history;
+
+create unique index event_history_key_sequence on event_history (user_id, key, sequence);
@@ -0,0 +1,12 @@
+-- JSON strings are unquoted by hand, other values come back as their JSON text.
+update event_snapshot
+set value = replace(replace(replace(replace(replace(substr(value, 2, length(value) - 2),
+    '\t', char(9)), '\r', char(13)), '\n', char(10)), '\"', '"'), '\\', '\')
+where value_type = 'string';
+alter table event_snapshot drop column value_type;
+
+update event_history
+set value = replace(replace(replace(replace(replace(substr(value, 2, length(value) - 2),
+    '\t', char(9)), '\r', char(13)), '\n', char(10)), '\"', '"'), '\\', '\')
+where value_type = 'string';
+alter table event_history drop column value_type;
@@ -0,0 +1,13 @@
+-- The bundled sqlite has no json functions, strings are quoted by hand.
+update event_snapshot
+set value = '"' || replace(replace(replace(replace(replace(value,
+    '\', '\\'), '"', '\"'), char(10), '\n'), char(13), '\r'), char(9), '\t') || '"'
+where value is not null;
+alter table event_snapshot add column value_type varchar(10);
+update event_snapshot set value_type = 'string' where value is not null;
+
+update event_history
+set value = case when action = 'delete' then null else '"' || replace(replace(replace(replace(replace(value,
+    '\', '\\'), '"', '\"'), char(10), '\n'), char(13), '\r'), char(9), '\t') || '"' end;
+alter table event_history add column value_type varchar(10);
+update event_history set value_type = 'string' where value is not null;
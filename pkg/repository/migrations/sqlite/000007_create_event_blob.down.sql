@@ -0,0 +1,7 @@
+drop index event_history_blob_hash;
+drop index event_snapshot_blob_hash;
+
+alter table event_history drop column blob_hash;
+alter table event_snapshot drop column blob_hash;
+
+drop table if exists event_blob;
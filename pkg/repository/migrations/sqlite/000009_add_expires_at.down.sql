@@ -0,0 +1,3 @@
+drop index event_snapshot_expires_at;
+alter table event_history drop column expires_at;
+alter table event_snapshot drop column expires_at;
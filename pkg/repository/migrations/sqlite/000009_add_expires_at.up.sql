@@ -0,0 +1,4 @@
+alter table event_snapshot add column expires_at timestamp;
+alter table event_history add column expires_at timestamp;
+
+create index event_snapshot_expires_at on event_snapshot (expires_at);
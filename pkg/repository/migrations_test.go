@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"event-history/pkg/config"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	for _, driver := range []string{config.PostgresDriver, config.MySQLDriver, config.SQLiteDriver} {
+		src, err := httpfs.New(http.FS(migrationFiles), path.Join("migrations", driver))
+		require.NoError(t, err, driver)
+
+		expected := uint(1)
+		for version, err := src.First(); !os.IsNotExist(err); version, err = src.Next(version) {
+			require.NoError(t, err, driver)
+			assert.Equal(t, expected, version, "%s migrations are numbered without gaps", driver)
+
+			_, _, upErr := src.ReadUp(version)
+			_, _, downErr := src.ReadDown(version)
+			assert.NoError(t, upErr, "%s migration %d has an up file", driver, version)
+			assert.NoError(t, downErr, "%s migration %d has a down file", driver, version)
+			expected++
+		}
+		assert.Greater(t, expected, uint(1), "%s has migrations", driver)
+	}
+}
+
+func TestGetMigrationStatus(t *testing.T) {
+	dbConfig := config.NewConfig("").GetDBConfig()
+
+	status, err := GetMigrationStatus(dbConfig)
+
+	require.NoError(t, err)
+	assert.False(t, status.Dirty)
+	assert.NotZero(t, status.Latest)
+	assert.Len(t, status.Pending, int(status.Latest-status.Version))
+}
+
+func TestMigrateTo_zero(t *testing.T) {
+	t.Setenv("DB_DRIVER", config.SQLiteDriver)
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "migrations.db"))
+	dbConfig := config.NewConfig("").GetDBConfig()
+	require.NoError(t, RunMigrations(dbConfig))
+
+	require.NoError(t, MigrateTo(dbConfig, 0))
+
+	status, err := GetMigrationStatus(dbConfig)
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), status.Version)
+	assert.Len(t, status.Pending, int(status.Latest))
+	require.NoError(t, MigrateTo(dbConfig, 0), "an empty schema stays empty")
+}
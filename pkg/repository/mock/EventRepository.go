@@ -9,6 +9,7 @@ import (
 	"event-history/pkg/eventinfo/model"
 	"event-history/pkg/repository"
 	"sync"
+	"time"
 )
 
 // Ensure, that EventRepositoryMock does implement repository.EventRepository.
@@ -21,18 +22,39 @@ var _ repository.EventRepository = &EventRepositoryMock{}
 //
 // 		// make and configure a mocked repository.EventRepository
 // 		mockedEventRepository := &EventRepositoryMock{
+// 			ApplyBatchFunc: func(ctx context.Context, batchId string, operations []dto.BatchOperation) ([]model.EventHistory, error) {
+// 				panic("mock out the ApplyBatch method")
+// 			},
+// 			CompareAndSwapFunc: func(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error) {
+// 				panic("mock out the CompareAndSwap method")
+// 			},
 // 			CreateKeyFunc: func(ctx context.Context, eventInfo *model.EventSnapshot) error {
 // 				panic("mock out the CreateKey method")
 // 			},
 // 			DeleteKeyFunc: func(ctx context.Context, query *dto.EventQuery) error {
 // 				panic("mock out the DeleteKey method")
 // 			},
+// 			ExpireKeysFunc: func(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error) {
+// 				panic("mock out the ExpireKeys method")
+// 			},
 // 			GetAnswerFunc: func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
 // 				panic("mock out the GetAnswer method")
 // 			},
-// 			GetHistoryFunc: func(ctx context.Context, query *dto.EventQuery) ([]model.EventHistory, error) {
+// 			GetAnswerAtFunc: func(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*model.EventSnapshot, error) {
+// 				panic("mock out the GetAnswerAt method")
+// 			},
+// 			GetHistoryFunc: func(ctx context.Context, query *dto.HistoryQuery) ([]model.EventHistory, string, error) {
 // 				panic("mock out the GetHistory method")
 // 			},
+// 			GetVersionFunc: func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error) {
+// 				panic("mock out the GetVersion method")
+// 			},
+// 			RestoreKeyFunc: func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+// 				panic("mock out the RestoreKey method")
+// 			},
+// 			RevertKeyFunc: func(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error) {
+// 				panic("mock out the RevertKey method")
+// 			},
 // 			UpdateKeyFunc: func(ctx context.Context, info *model.EventSnapshot) error {
 // 				panic("mock out the UpdateKey method")
 // 			},
@@ -43,23 +65,62 @@ var _ repository.EventRepository = &EventRepositoryMock{}
 //
 // 	}
 type EventRepositoryMock struct {
+	// ApplyBatchFunc mocks the ApplyBatch method.
+	ApplyBatchFunc func(ctx context.Context, batchId string, operations []dto.BatchOperation) ([]model.EventHistory, error)
+
+	// CompareAndSwapFunc mocks the CompareAndSwap method.
+	CompareAndSwapFunc func(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error)
+
 	// CreateKeyFunc mocks the CreateKey method.
 	CreateKeyFunc func(ctx context.Context, eventInfo *model.EventSnapshot) error
 
 	// DeleteKeyFunc mocks the DeleteKey method.
 	DeleteKeyFunc func(ctx context.Context, query *dto.EventQuery) error
 
+	// ExpireKeysFunc mocks the ExpireKeys method.
+	ExpireKeysFunc func(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error)
+
 	// GetAnswerFunc mocks the GetAnswer method.
 	GetAnswerFunc func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error)
 
+	// GetAnswerAtFunc mocks the GetAnswerAt method.
+	GetAnswerAtFunc func(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*model.EventSnapshot, error)
+
 	// GetHistoryFunc mocks the GetHistory method.
-	GetHistoryFunc func(ctx context.Context, query *dto.EventQuery) ([]model.EventHistory, error)
+	GetHistoryFunc func(ctx context.Context, query *dto.HistoryQuery) ([]model.EventHistory, string, error)
+
+	// GetVersionFunc mocks the GetVersion method.
+	GetVersionFunc func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error)
+
+	// RestoreKeyFunc mocks the RestoreKey method.
+	RestoreKeyFunc func(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error)
+
+	// RevertKeyFunc mocks the RevertKey method.
+	RevertKeyFunc func(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error)
 
 	// UpdateKeyFunc mocks the UpdateKey method.
 	UpdateKeyFunc func(ctx context.Context, info *model.EventSnapshot) error
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// ApplyBatch holds details about calls to the ApplyBatch method.
+		ApplyBatch []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// BatchId is the batchId argument value.
+			BatchId string
+			// Operations is the operations argument value.
+			Operations []dto.BatchOperation
+		}
+		// CompareAndSwap holds details about calls to the CompareAndSwap method.
+		CompareAndSwap []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EventInfo is the eventInfo argument value.
+			EventInfo *model.EventSnapshot
+			// Expected is the expected argument value.
+			Expected model.JSONValue
+		}
 		// CreateKey holds details about calls to the CreateKey method.
 		CreateKey []struct {
 			// Ctx is the ctx argument value.
@@ -74,6 +135,15 @@ type EventRepositoryMock struct {
 			// Query is the query argument value.
 			Query *dto.EventQuery
 		}
+		// ExpireKeys holds details about calls to the ExpireKeys method.
+		ExpireKeys []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Now is the now argument value.
+			Now time.Time
+			// Limit is the limit argument value.
+			Limit int
+		}
 		// GetAnswer holds details about calls to the GetAnswer method.
 		GetAnswer []struct {
 			// Ctx is the ctx argument value.
@@ -81,12 +151,42 @@ type EventRepositoryMock struct {
 			// EventQuery is the eventQuery argument value.
 			EventQuery *dto.EventQuery
 		}
+		// GetAnswerAt holds details about calls to the GetAnswerAt method.
+		GetAnswerAt []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EventQuery is the eventQuery argument value.
+			EventQuery *dto.EventQuery
+			// At is the at argument value.
+			At time.Time
+		}
 		// GetHistory holds details about calls to the GetHistory method.
 		GetHistory []struct {
 			// Ctx is the ctx argument value.
 			Ctx context.Context
 			// Query is the query argument value.
-			Query *dto.EventQuery
+			Query *dto.HistoryQuery
+		}
+		// GetVersion holds details about calls to the GetVersion method.
+		GetVersion []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EventQuery is the eventQuery argument value.
+			EventQuery *dto.EventQuery
+		}
+		// RestoreKey holds details about calls to the RestoreKey method.
+		RestoreKey []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// EventQuery is the eventQuery argument value.
+			EventQuery *dto.EventQuery
+		}
+		// RevertKey holds details about calls to the RevertKey method.
+		RevertKey []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// RevertQuery is the revertQuery argument value.
+			RevertQuery *dto.RevertQuery
 		}
 		// UpdateKey holds details about calls to the UpdateKey method.
 		UpdateKey []struct {
@@ -96,11 +196,96 @@ type EventRepositoryMock struct {
 			Info *model.EventSnapshot
 		}
 	}
-	lockCreateKey  sync.RWMutex
-	lockDeleteKey  sync.RWMutex
-	lockGetAnswer  sync.RWMutex
-	lockGetHistory sync.RWMutex
-	lockUpdateKey  sync.RWMutex
+	lockApplyBatch     sync.RWMutex
+	lockCompareAndSwap sync.RWMutex
+	lockCreateKey      sync.RWMutex
+	lockDeleteKey      sync.RWMutex
+	lockExpireKeys     sync.RWMutex
+	lockGetAnswer      sync.RWMutex
+	lockGetAnswerAt    sync.RWMutex
+	lockGetHistory     sync.RWMutex
+	lockGetVersion     sync.RWMutex
+	lockRestoreKey     sync.RWMutex
+	lockRevertKey      sync.RWMutex
+	lockUpdateKey      sync.RWMutex
+}
+
+// ApplyBatch calls ApplyBatchFunc.
+func (mock *EventRepositoryMock) ApplyBatch(ctx context.Context, batchId string, operations []dto.BatchOperation) ([]model.EventHistory, error) {
+	if mock.ApplyBatchFunc == nil {
+		panic("EventRepositoryMock.ApplyBatchFunc: method is nil but EventRepository.ApplyBatch was just called")
+	}
+	callInfo := struct {
+		Ctx        context.Context
+		BatchId    string
+		Operations []dto.BatchOperation
+	}{
+		Ctx:        ctx,
+		BatchId:    batchId,
+		Operations: operations,
+	}
+	mock.lockApplyBatch.Lock()
+	mock.calls.ApplyBatch = append(mock.calls.ApplyBatch, callInfo)
+	mock.lockApplyBatch.Unlock()
+	return mock.ApplyBatchFunc(ctx, batchId, operations)
+}
+
+// ApplyBatchCalls gets all the calls that were made to ApplyBatch.
+// Check the length with:
+//     len(mockedEventRepository.ApplyBatchCalls())
+func (mock *EventRepositoryMock) ApplyBatchCalls() []struct {
+	Ctx        context.Context
+	BatchId    string
+	Operations []dto.BatchOperation
+} {
+	var calls []struct {
+		Ctx        context.Context
+		BatchId    string
+		Operations []dto.BatchOperation
+	}
+	mock.lockApplyBatch.RLock()
+	calls = mock.calls.ApplyBatch
+	mock.lockApplyBatch.RUnlock()
+	return calls
+}
+
+// CompareAndSwap calls CompareAndSwapFunc.
+func (mock *EventRepositoryMock) CompareAndSwap(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error) {
+	if mock.CompareAndSwapFunc == nil {
+		panic("EventRepositoryMock.CompareAndSwapFunc: method is nil but EventRepository.CompareAndSwap was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		EventInfo *model.EventSnapshot
+		Expected  model.JSONValue
+	}{
+		Ctx:       ctx,
+		EventInfo: eventInfo,
+		Expected:  expected,
+	}
+	mock.lockCompareAndSwap.Lock()
+	mock.calls.CompareAndSwap = append(mock.calls.CompareAndSwap, callInfo)
+	mock.lockCompareAndSwap.Unlock()
+	return mock.CompareAndSwapFunc(ctx, eventInfo, expected)
+}
+
+// CompareAndSwapCalls gets all the calls that were made to CompareAndSwap.
+// Check the length with:
+//     len(mockedEventRepository.CompareAndSwapCalls())
+func (mock *EventRepositoryMock) CompareAndSwapCalls() []struct {
+	Ctx       context.Context
+	EventInfo *model.EventSnapshot
+	Expected  model.JSONValue
+} {
+	var calls []struct {
+		Ctx       context.Context
+		EventInfo *model.EventSnapshot
+		Expected  model.JSONValue
+	}
+	mock.lockCompareAndSwap.RLock()
+	calls = mock.calls.CompareAndSwap
+	mock.lockCompareAndSwap.RUnlock()
+	return calls
 }
 
 // CreateKey calls CreateKeyFunc.
@@ -173,6 +358,45 @@ func (mock *EventRepositoryMock) DeleteKeyCalls() []struct {
 	return calls
 }
 
+// ExpireKeys calls ExpireKeysFunc.
+func (mock *EventRepositoryMock) ExpireKeys(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error) {
+	if mock.ExpireKeysFunc == nil {
+		panic("EventRepositoryMock.ExpireKeysFunc: method is nil but EventRepository.ExpireKeys was just called")
+	}
+	callInfo := struct {
+		Ctx   context.Context
+		Now   time.Time
+		Limit int
+	}{
+		Ctx:   ctx,
+		Now:   now,
+		Limit: limit,
+	}
+	mock.lockExpireKeys.Lock()
+	mock.calls.ExpireKeys = append(mock.calls.ExpireKeys, callInfo)
+	mock.lockExpireKeys.Unlock()
+	return mock.ExpireKeysFunc(ctx, now, limit)
+}
+
+// ExpireKeysCalls gets all the calls that were made to ExpireKeys.
+// Check the length with:
+//     len(mockedEventRepository.ExpireKeysCalls())
+func (mock *EventRepositoryMock) ExpireKeysCalls() []struct {
+	Ctx   context.Context
+	Now   time.Time
+	Limit int
+} {
+	var calls []struct {
+		Ctx   context.Context
+		Now   time.Time
+		Limit int
+	}
+	mock.lockExpireKeys.RLock()
+	calls = mock.calls.ExpireKeys
+	mock.lockExpireKeys.RUnlock()
+	return calls
+}
+
 // GetAnswer calls GetAnswerFunc.
 func (mock *EventRepositoryMock) GetAnswer(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
 	if mock.GetAnswerFunc == nil {
@@ -208,14 +432,53 @@ func (mock *EventRepositoryMock) GetAnswerCalls() []struct {
 	return calls
 }
 
+// GetAnswerAt calls GetAnswerAtFunc.
+func (mock *EventRepositoryMock) GetAnswerAt(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*model.EventSnapshot, error) {
+	if mock.GetAnswerAtFunc == nil {
+		panic("EventRepositoryMock.GetAnswerAtFunc: method is nil but EventRepository.GetAnswerAt was just called")
+	}
+	callInfo := struct {
+		Ctx        context.Context
+		EventQuery *dto.EventQuery
+		At         time.Time
+	}{
+		Ctx:        ctx,
+		EventQuery: eventQuery,
+		At:         at,
+	}
+	mock.lockGetAnswerAt.Lock()
+	mock.calls.GetAnswerAt = append(mock.calls.GetAnswerAt, callInfo)
+	mock.lockGetAnswerAt.Unlock()
+	return mock.GetAnswerAtFunc(ctx, eventQuery, at)
+}
+
+// GetAnswerAtCalls gets all the calls that were made to GetAnswerAt.
+// Check the length with:
+//     len(mockedEventRepository.GetAnswerAtCalls())
+func (mock *EventRepositoryMock) GetAnswerAtCalls() []struct {
+	Ctx        context.Context
+	EventQuery *dto.EventQuery
+	At         time.Time
+} {
+	var calls []struct {
+		Ctx        context.Context
+		EventQuery *dto.EventQuery
+		At         time.Time
+	}
+	mock.lockGetAnswerAt.RLock()
+	calls = mock.calls.GetAnswerAt
+	mock.lockGetAnswerAt.RUnlock()
+	return calls
+}
+
 // GetHistory calls GetHistoryFunc.
-func (mock *EventRepositoryMock) GetHistory(ctx context.Context, query *dto.EventQuery) ([]model.EventHistory, error) {
+func (mock *EventRepositoryMock) GetHistory(ctx context.Context, query *dto.HistoryQuery) ([]model.EventHistory, string, error) {
 	if mock.GetHistoryFunc == nil {
 		panic("EventRepositoryMock.GetHistoryFunc: method is nil but EventRepository.GetHistory was just called")
 	}
 	callInfo := struct {
 		Ctx   context.Context
-		Query *dto.EventQuery
+		Query *dto.HistoryQuery
 	}{
 		Ctx:   ctx,
 		Query: query,
@@ -231,11 +494,11 @@ func (mock *EventRepositoryMock) GetHistory(ctx context.Context, query *dto.Even
 //     len(mockedEventRepository.GetHistoryCalls())
 func (mock *EventRepositoryMock) GetHistoryCalls() []struct {
 	Ctx   context.Context
-	Query *dto.EventQuery
+	Query *dto.HistoryQuery
 } {
 	var calls []struct {
 		Ctx   context.Context
-		Query *dto.EventQuery
+		Query *dto.HistoryQuery
 	}
 	mock.lockGetHistory.RLock()
 	calls = mock.calls.GetHistory
@@ -243,6 +506,111 @@ func (mock *EventRepositoryMock) GetHistoryCalls() []struct {
 	return calls
 }
 
+// GetVersion calls GetVersionFunc.
+func (mock *EventRepositoryMock) GetVersion(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error) {
+	if mock.GetVersionFunc == nil {
+		panic("EventRepositoryMock.GetVersionFunc: method is nil but EventRepository.GetVersion was just called")
+	}
+	callInfo := struct {
+		Ctx        context.Context
+		EventQuery *dto.EventQuery
+	}{
+		Ctx:        ctx,
+		EventQuery: eventQuery,
+	}
+	mock.lockGetVersion.Lock()
+	mock.calls.GetVersion = append(mock.calls.GetVersion, callInfo)
+	mock.lockGetVersion.Unlock()
+	return mock.GetVersionFunc(ctx, eventQuery)
+}
+
+// GetVersionCalls gets all the calls that were made to GetVersion.
+// Check the length with:
+//     len(mockedEventRepository.GetVersionCalls())
+func (mock *EventRepositoryMock) GetVersionCalls() []struct {
+	Ctx        context.Context
+	EventQuery *dto.EventQuery
+} {
+	var calls []struct {
+		Ctx        context.Context
+		EventQuery *dto.EventQuery
+	}
+	mock.lockGetVersion.RLock()
+	calls = mock.calls.GetVersion
+	mock.lockGetVersion.RUnlock()
+	return calls
+}
+
+// RestoreKey calls RestoreKeyFunc.
+func (mock *EventRepositoryMock) RestoreKey(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+	if mock.RestoreKeyFunc == nil {
+		panic("EventRepositoryMock.RestoreKeyFunc: method is nil but EventRepository.RestoreKey was just called")
+	}
+	callInfo := struct {
+		Ctx        context.Context
+		EventQuery *dto.EventQuery
+	}{
+		Ctx:        ctx,
+		EventQuery: eventQuery,
+	}
+	mock.lockRestoreKey.Lock()
+	mock.calls.RestoreKey = append(mock.calls.RestoreKey, callInfo)
+	mock.lockRestoreKey.Unlock()
+	return mock.RestoreKeyFunc(ctx, eventQuery)
+}
+
+// RestoreKeyCalls gets all the calls that were made to RestoreKey.
+// Check the length with:
+//     len(mockedEventRepository.RestoreKeyCalls())
+func (mock *EventRepositoryMock) RestoreKeyCalls() []struct {
+	Ctx        context.Context
+	EventQuery *dto.EventQuery
+} {
+	var calls []struct {
+		Ctx        context.Context
+		EventQuery *dto.EventQuery
+	}
+	mock.lockRestoreKey.RLock()
+	calls = mock.calls.RestoreKey
+	mock.lockRestoreKey.RUnlock()
+	return calls
+}
+
+// RevertKey calls RevertKeyFunc.
+func (mock *EventRepositoryMock) RevertKey(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error) {
+	if mock.RevertKeyFunc == nil {
+		panic("EventRepositoryMock.RevertKeyFunc: method is nil but EventRepository.RevertKey was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		RevertQuery *dto.RevertQuery
+	}{
+		Ctx:         ctx,
+		RevertQuery: revertQuery,
+	}
+	mock.lockRevertKey.Lock()
+	mock.calls.RevertKey = append(mock.calls.RevertKey, callInfo)
+	mock.lockRevertKey.Unlock()
+	return mock.RevertKeyFunc(ctx, revertQuery)
+}
+
+// RevertKeyCalls gets all the calls that were made to RevertKey.
+// Check the length with:
+//     len(mockedEventRepository.RevertKeyCalls())
+func (mock *EventRepositoryMock) RevertKeyCalls() []struct {
+	Ctx         context.Context
+	RevertQuery *dto.RevertQuery
+} {
+	var calls []struct {
+		Ctx         context.Context
+		RevertQuery *dto.RevertQuery
+	}
+	mock.lockRevertKey.RLock()
+	calls = mock.calls.RevertKey
+	mock.lockRevertKey.RUnlock()
+	return calls
+}
+
 // UpdateKey calls UpdateKeyFunc.
 func (mock *EventRepositoryMock) UpdateKey(ctx context.Context, info *model.EventSnapshot) error {
 	if mock.UpdateKeyFunc == nil {
@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrPartitioningUnsupported = errors.New("event_history is only partitioned on postgres")
+
+const (
+	defaultPartition     = "event_history_default"
+	partitionNamePrefix  = "event_history_"
+	partitionNameLayout  = "2006_01"
+	partitionBoundLayout = "2006-01-02 15:04:05"
+)
+
+// partitionBound matches the bound postgres reports for a range partition, the
+// default partition has none.
+var partitionBound = regexp.MustCompile(`FROM \('([^']+)'\) TO \('([^']+)'\)`)
+
+// Partition is a partition of event_history holding the records created in
+// [From, To).
+type Partition struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// PartitionOptions keeps a monthly partition ready for the current month and
+// the Ahead months after it. With RetainMonths set, the partitions that only
+// hold records older than that many months before the current one are
+// detached and, unless DetachOnly, dropped. The records of an expired
+// partition that are the latest of their key are moved to the default
+// partition first, as the snapshot of the key relies on them. With DryRun
+// nothing is changed.
+type PartitionOptions struct {
+	Ahead        int
+	RetainMonths int
+	DetachOnly   bool
+	DryRun       bool
+}
+
+// PartitionResult names the partitions a maintenance run created, detached and
+// dropped. Kept counts the records moved out of the expired partitions.
+type PartitionResult struct {
+	DryRun   bool     `json:"dry_run"`
+	Created  []string `json:"created"`
+	Detached []string `json:"detached"`
+	Dropped  []string `json:"dropped"`
+	Kept     int64    `json:"kept"`
+}
+
+type PartitionManager interface {
+	Partitions(ctx context.Context) ([]Partition, error)
+	Maintain(ctx context.Context, opts PartitionOptions) (*PartitionResult, error)
+}
+
+type postgresPartitionManager struct {
+	db  *gorm.DB
+	uow UnitOfWork
+	now func() time.Time
+}
+
+// Partitions lists the range partitions of event_history ordered by From.
+func (ppm *postgresPartitionManager) Partitions(ctx context.Context) ([]Partition, error) {
+	if ppm.db.Dialector.Name() != "postgres" {
+		return nil, ErrPartitioningUnsupported
+	}
+
+	var rows []struct {
+		Name  string
+		Bound string
+	}
+	err := ppm.db.WithContext(ctx).Raw(`select c.relname as name, pg_get_expr(c.relpartbound, c.oid) as bound
+		from pg_inherits i join pg_class c on c.oid = i.inhrelid
+		where i.inhparent = 'event_history'::regclass`).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of event_history, error: %w", err)
+	}
+
+	partitions := make([]Partition, 0, len(rows))
+	for _, row := range rows {
+		bounds := partitionBound.FindStringSubmatch(row.Bound)
+		if bounds == nil {
+			continue
+		}
+
+		from, fromErr := time.Parse(partitionBoundLayout, bounds[1])
+		to, toErr := time.Parse(partitionBoundLayout, bounds[2])
+		if fromErr != nil || toErr != nil {
+			return nil, fmt.Errorf("partition %s has an unexpected bound %q", row.Name, row.Bound)
+		}
+		partitions = append(partitions, Partition{Name: row.Name, From: from, To: to})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].From.Before(partitions[j].From) })
+	return partitions, nil
+}
+
+// Maintain creates the missing partitions first, so that a failure to drop
+// expired ones never leaves upcoming records in the default partition.
+func (ppm *postgresPartitionManager) Maintain(ctx context.Context, opts PartitionOptions) (*PartitionResult, error) {
+	partitions, err := ppm.Partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	missing, expired := planPartitions(partitions, ppm.now(), opts)
+	result := &PartitionResult{DryRun: opts.DryRun, Created: []string{}, Detached: []string{}, Dropped: []string{}}
+
+	for _, partition := range missing {
+		if !opts.DryRun {
+			if err := ppm.uow.Do(ctx, func(tx *gorm.DB) error { return createPartition(tx, partition) }); err != nil {
+				return nil, fmt.Errorf("failed to create partition %s, error: %w", partition.Name, err)
+			}
+		}
+		result.Created = append(result.Created, partition.Name)
+	}
+
+	for _, partition := range expired {
+		var kept int64
+		err := ppm.uow.Do(ctx, func(tx *gorm.DB) (err error) {
+			kept, err = expirePartition(tx, partition, opts)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to expire partition %s, error: %w", partition.Name, err)
+		}
+
+		result.Kept += kept
+		result.Detached = append(result.Detached, partition.Name)
+		if !opts.DetachOnly {
+			result.Dropped = append(result.Dropped, partition.Name)
+		}
+	}
+
+	return result, nil
+}
+
+// statement is one statement of a partition change, the changes are made of
+// several that have to run in the same transaction.
+type statement struct {
+	sql  string
+	vars []interface{}
+}
+
+func execAll(tx *gorm.DB, statements ...statement) error {
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt.sql, stmt.vars...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPartition creates the partition as a table of its own, moves the rows
+// of its month out of the default partition into it and then attaches it.
+// Postgres refuses to create a partition whose rows the default partition
+// already holds, which happens when a month went by without one. The default
+// partition is locked against writes throughout, otherwise a record written
+// in between would be left behind in it and the attach would fail. Partition
+// bounds take no bind variables, they are formatted from the month instead.
+func createPartition(tx *gorm.DB, partition Partition) error {
+	table, defaults := clause.Table{Name: partition.Name}, clause.Table{Name: defaultPartition}
+	from, to := partition.From.UTC(), partition.To.UTC()
+
+	return execAll(tx,
+		statement{"lock table ? in share row exclusive mode", []interface{}{defaults}},
+		statement{"create table ? (like event_history including defaults)", []interface{}{table}},
+		statement{"insert into ? select * from ? where created_at >= ? and created_at < ?", []interface{}{table, defaults, from, to}},
+		statement{"delete from ? where created_at >= ? and created_at < ?", []interface{}{defaults, from, to}},
+		statement{fmt.Sprintf("alter table event_history attach partition ? for values from ('%s') to ('%s')",
+			from.Format(partitionBoundLayout), to.Format(partitionBoundLayout)), []interface{}{table}},
+	)
+}
+
+// expirePartition detaches the partition and drops it unless opts.DetachOnly.
+// The records of the partition that no later record of their key supersedes
+// are moved out first and land in the default partition, as no partition
+// covers their month any more. It returns how many records it moved, or would
+// move with opts.DryRun.
+func expirePartition(tx *gorm.DB, partition Partition, opts PartitionOptions) (int64, error) {
+	table := clause.Table{Name: partition.Name}
+	latest := clause.Expr{
+		SQL: `select * from ? p where not exists (
+		select 1 from event_history h where h.user_id = p.user_id and h.key = p.key and h.sequence > p.sequence)`,
+		Vars: []interface{}{table},
+	}
+
+	var kept int64
+	if opts.DryRun {
+		err := tx.Raw("select count(*) from (?) latest", latest).Scan(&kept).Error
+		return kept, err
+	}
+
+	if err := tx.Exec("create temporary table event_history_kept on commit drop as ?", latest).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Raw("select count(*) from event_history_kept").Scan(&kept).Error; err != nil {
+		return 0, err
+	}
+
+	err := execAll(tx,
+		statement{"alter table event_history detach partition ?", []interface{}{table}},
+		statement{"insert into event_history select * from event_history_kept", nil},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.DetachOnly {
+		err = tx.Exec("delete from ? p using event_history_kept k where p.event_offset = k.event_offset", table).Error
+	} else {
+		err = tx.Exec("drop table ?", table).Error
+	}
+	return kept, err
+}
+
+// planPartitions returns the monthly partitions to create, from the month of
+// now up to opts.Ahead months after it, and the existing ones that expired.
+// A month that an existing partition overlaps is not created.
+func planPartitions(partitions []Partition, now time.Time, opts PartitionOptions) ([]Partition, []Partition) {
+	now = now.UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var missing []Partition
+	for i := 0; i <= opts.Ahead; i++ {
+		month := Partition{From: current.AddDate(0, i, 0), To: current.AddDate(0, i+1, 0)}
+		month.Name = partitionNamePrefix + month.From.Format(partitionNameLayout)
+		if !overlapsAny(partitions, month) {
+			missing = append(missing, month)
+		}
+	}
+
+	var expired []Partition
+	if opts.RetainMonths > 0 {
+		cutoff := current.AddDate(0, -opts.RetainMonths, 0)
+		for _, partition := range partitions {
+			if !partition.To.After(cutoff) {
+				expired = append(expired, partition)
+			}
+		}
+	}
+
+	return missing, expired
+}
+
+func overlapsAny(partitions []Partition, month Partition) bool {
+	for _, partition := range partitions {
+		if partition.From.Before(month.To) && partition.To.After(month.From) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPartitionManager manages the partitions of event_history in db, which has
+// to be postgres.
+func NewPartitionManager(db *gorm.DB) PartitionManager {
+	return &postgresPartitionManager{
+		db:  db,
+		uow: NewUnitOfWork(db),
+		now: time.Now,
+	}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"event-history/pkg/eventinfo/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/clause"
+)
+
+func TestPlanPartitions(t *testing.T) {
+	month := func(year int, month time.Month) Partition {
+		from := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return Partition{Name: partitionNamePrefix + from.Format(partitionNameLayout), From: from, To: from.AddDate(0, 1, 0)}
+	}
+	partitions := []Partition{month(2021, 10), month(2021, 11), month(2021, 12), month(2022, 1), month(2022, 2)}
+	now := time.Date(2022, 2, 14, 10, 0, 0, 0, time.UTC)
+
+	missing, expired := planPartitions(partitions, now, PartitionOptions{Ahead: 2, RetainMonths: 3})
+
+	assert.Equal(t, []Partition{month(2022, 3), month(2022, 4)}, missing)
+	assert.Equal(t, []Partition{month(2021, 10)}, expired)
+
+	missing, expired = planPartitions(partitions, now, PartitionOptions{})
+
+	assert.Empty(t, missing)
+	assert.Empty(t, expired)
+}
+
+func TestPostgresPartitionManager_Maintain_movesDefaultRows(t *testing.T) {
+	dbConn, ctx := setUp()
+	if dbConn.Dialector.Name() != "postgres" {
+		t.Skip("event_history is only partitioned on postgres")
+	}
+	month := time.Date(2031, 5, 1, 0, 0, 0, 0, time.UTC)
+	name := partitionNamePrefix + month.Format(partitionNameLayout)
+	t.Cleanup(func() {
+		dbConn.Exec("drop table if exists ?", clause.Table{Name: name})
+		dbConn.Where("user_id = ?", userId).Delete(&model.EventHistory{})
+	})
+	require.NoError(t, dbConn.WithContext(ctx).Create(&model.EventHistory{
+		Key: "name", Value: `"john"`, UserId: userId, Action: model.CreateAction, CreatedAt: month.Add(time.Hour), Sequence: 1,
+	}).Error)
+	manager := NewPartitionManager(dbConn).(*postgresPartitionManager)
+	manager.now = func() time.Time { return month.Add(24 * time.Hour) }
+
+	result, err := manager.Maintain(ctx, PartitionOptions{})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{name}, result.Created)
+	var moved, left int64
+	dbConn.Table(name).Where("user_id = ?", userId).Count(&moved)
+	dbConn.Table(defaultPartition).Where("user_id = ?", userId).Count(&left)
+	assert.Equal(t, int64(1), moved)
+	assert.Equal(t, int64(0), left)
+}
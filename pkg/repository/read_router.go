@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const replicaPingTimeout = time.Second
+
+// ReadRouter picks the connection a read goes to. Writes always go to the
+// primary, and so do the reads of a user that wrote within the read after
+// write window, as the replicas may not have caught up with the write yet.
+type ReadRouter interface {
+	// Reader returns the connection for a read of userId.
+	Reader(userId string) *gorm.DB
+	// Wrote records a write of userId.
+	Wrote(userId string)
+}
+
+type primaryRouter struct {
+	primary *gorm.DB
+}
+
+func (pr *primaryRouter) Reader(string) *gorm.DB {
+	return pr.primary
+}
+
+func (pr *primaryRouter) Wrote(string) {}
+
+type replica struct {
+	db      *gorm.DB
+	healthy int32
+}
+
+// ReplicaRouter spreads reads round robin over the replicas that passed their
+// last health check, falling back to the primary when none did.
+type ReplicaRouter struct {
+	primary        *gorm.DB
+	replicas       []*replica
+	next           uint32
+	readAfterWrite time.Duration
+	now            func() time.Time
+
+	mu      sync.Mutex
+	writes  map[string]time.Time
+	sweepAt time.Time
+}
+
+func (rr *ReplicaRouter) Reader(userId string) *gorm.DB {
+	if rr.recentlyWrote(userId) {
+		return rr.primary
+	}
+
+	for range rr.replicas {
+		candidate := rr.replicas[int(atomic.AddUint32(&rr.next, 1))%len(rr.replicas)]
+		if atomic.LoadInt32(&candidate.healthy) == 1 {
+			return candidate.db
+		}
+	}
+	return rr.primary
+}
+
+func (rr *ReplicaRouter) Wrote(userId string) {
+	if rr.readAfterWrite <= 0 {
+		return
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	now := rr.now()
+	rr.writes[userId] = now
+	if !now.Before(rr.sweepAt) {
+		rr.sweep(now)
+	}
+}
+
+func (rr *ReplicaRouter) recentlyWrote(userId string) bool {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	wroteAt, ok := rr.writes[userId]
+	if ok && rr.now().Sub(wroteAt) >= rr.readAfterWrite {
+		delete(rr.writes, userId)
+		return false
+	}
+	return ok
+}
+
+// sweep forgets the writes that are out of the read after write window. Wrote
+// sweeps at most once per window, so the writes of users that do not read
+// again go away without a pass over all of them on every write.
+func (rr *ReplicaRouter) sweep(now time.Time) {
+	for userId, wroteAt := range rr.writes {
+		if now.Sub(wroteAt) >= rr.readAfterWrite {
+			delete(rr.writes, userId)
+		}
+	}
+	rr.sweepAt = now.Add(rr.readAfterWrite)
+}
+
+// Run checks the health of the replicas every interval until ctx is done, a
+// zero interval turns the checks off.
+func (rr *ReplicaRouter) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rr.CheckHealth(ctx)
+		}
+	}
+}
+
+// CheckHealth pings every replica.
+func (rr *ReplicaRouter) CheckHealth(ctx context.Context) {
+	for _, r := range rr.replicas {
+		var healthy int32
+		if pingReplica(ctx, r.db) == nil {
+			healthy = 1
+		}
+		atomic.StoreInt32(&r.healthy, healthy)
+	}
+}
+
+// Healthy counts the replicas that passed their last health check.
+func (rr *ReplicaRouter) Healthy() int {
+	healthy := 0
+	for _, r := range rr.replicas {
+		healthy += int(atomic.LoadInt32(&r.healthy))
+	}
+	return healthy
+}
+
+func pingReplica(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// NewPrimaryRouter sends every read to primary.
+func NewPrimaryRouter(primary *gorm.DB) ReadRouter {
+	return &primaryRouter{
+		primary: primary,
+	}
+}
+
+// NewReplicaRouter sends reads to replicas, which count as unhealthy until
+// their first health check.
+func NewReplicaRouter(primary *gorm.DB, replicas []*gorm.DB, readAfterWrite time.Duration) *ReplicaRouter {
+	router := &ReplicaRouter{
+		primary:        primary,
+		readAfterWrite: readAfterWrite,
+		now:            time.Now,
+		writes:         map[string]time.Time{},
+	}
+	for _, db := range replicas {
+		router.replicas = append(router.replicas, &replica{db: db})
+	}
+	return router
+}
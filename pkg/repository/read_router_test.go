@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestReplicaRouter(t *testing.T) {
+	open := func() *gorm.DB {
+		db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		require.NoError(t, err)
+		return db
+	}
+	primary, replica, down := open(), open(), open()
+	sqlDB, _ := down.DB()
+	require.NoError(t, sqlDB.Close())
+	now := time.Now()
+	router := NewReplicaRouter(primary, []*gorm.DB{replica, down}, time.Second)
+	router.now = func() time.Time { return now }
+
+	assert.Same(t, primary, router.Reader(userId), "replicas are unhealthy until checked")
+
+	router.CheckHealth(context.Background())
+
+	assert.Equal(t, 1, router.Healthy())
+	assert.Same(t, replica, router.Reader(userId))
+	assert.Same(t, replica, router.Reader(userId))
+
+	router.Wrote(userId)
+
+	assert.Same(t, primary, router.Reader(userId))
+	assert.Same(t, replica, router.Reader("user2"))
+
+	now = now.Add(time.Second)
+
+	assert.Same(t, replica, router.Reader(userId))
+}
+
+func TestReplicaRouter_forgetsWritesWithoutHealthChecks(t *testing.T) {
+	primary, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	now := time.Now()
+	router := NewReplicaRouter(primary, nil, time.Second)
+	router.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router.Run(ctx, 0)
+
+	router.Wrote(userId)
+	router.Wrote("user2")
+	now = now.Add(time.Second)
+	router.Reader(userId)
+
+	assert.NotContains(t, router.writes, userId, "a read forgets an expired write")
+	assert.Contains(t, router.writes, "user2")
+
+	router.Wrote("user3")
+
+	assert.Equal(t, map[string]time.Time{"user3": now}, router.writes, "a write sweeps the expired writes")
+}
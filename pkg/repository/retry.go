@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+)
+
+// RetryPolicy retries an operation up to MaxAttempts times in all, waiting a
+// random delay of up to BaseDelay doubled for every attempt made, capped at
+// MaxDelay, in between.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 50 * time.Millisecond, MaxDelay: time.Second}
+
+// retryingEventRepository retries the operations of the wrapped repository
+// that fail with a transient database error. Every write of the repository is
+// one unit of work, so a failed attempt has been rolled back as a whole and
+// retrying it writes its history once. A failed commit is never retried, as the
+// transaction may have been committed after all. The timeouts bound an
+// operation across all of its attempts rather than each attempt.
+type retryingEventRepository struct {
+	EventRepository
+	policy   RetryPolicy
+	timeouts QueryTimeouts
+	sleep    func(ctx context.Context, delay time.Duration) error
+	jitter   func(n int64) int64
+}
+
+func (rer *retryingEventRepository) CreateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
+	return rer.retry(ctx, rer.timeouts.Write, func(ctx context.Context) error {
+		return rer.EventRepository.CreateKey(ctx, eventInfo)
+	})
+}
+
+func (rer *retryingEventRepository) GetAnswer(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+	var res *model.EventSnapshot
+	err := rer.retry(ctx, rer.timeouts.Read, func(ctx context.Context) (err error) {
+		res, err = rer.EventRepository.GetAnswer(ctx, eventQuery)
+		return err
+	})
+	return res, err
+}
+
+func (rer *retryingEventRepository) GetAnswerAt(ctx context.Context, eventQuery *dto.EventQuery, at time.Time) (*model.EventSnapshot, error) {
+	var res *model.EventSnapshot
+	err := rer.retry(ctx, rer.timeouts.Read, func(ctx context.Context) (err error) {
+		res, err = rer.EventRepository.GetAnswerAt(ctx, eventQuery, at)
+		return err
+	})
+	return res, err
+}
+
+func (rer *retryingEventRepository) DeleteKey(ctx context.Context, eventQuery *dto.EventQuery) error {
+	return rer.retry(ctx, rer.timeouts.Write, func(ctx context.Context) error {
+		return rer.EventRepository.DeleteKey(ctx, eventQuery)
+	})
+}
+
+func (rer *retryingEventRepository) UpdateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
+	return rer.retry(ctx, rer.timeouts.Write, func(ctx context.Context) error {
+		return rer.EventRepository.UpdateKey(ctx, eventInfo)
+	})
+}
+
+func (rer *retryingEventRepository) GetHistory(ctx context.Context, historyQuery *dto.HistoryQuery) ([]model.EventHistory, string, error) {
+	var history []model.EventHistory
+	var nextCursor string
+	err := rer.retry(ctx, rer.timeouts.Read, func(ctx context.Context) (err error) {
+		history, nextCursor, err = rer.EventRepository.GetHistory(ctx, historyQuery)
+		return err
+	})
+	return history, nextCursor, err
+}
+
+func (rer *retryingEventRepository) ApplyBatch(ctx context.Context, batchId string, operations []dto.BatchOperation) ([]model.EventHistory, error) {
+	var history []model.EventHistory
+	err := rer.retry(ctx, rer.timeouts.Batch, func(ctx context.Context) (err error) {
+		history, err = rer.EventRepository.ApplyBatch(ctx, batchId, operations)
+		return err
+	})
+	return history, err
+}
+
+func (rer *retryingEventRepository) CompareAndSwap(ctx context.Context, eventInfo *model.EventSnapshot, expected model.JSONValue) (*model.EventSnapshot, error) {
+	var res *model.EventSnapshot
+	err := rer.retry(ctx, rer.timeouts.Write, func(ctx context.Context) (err error) {
+		res, err = rer.EventRepository.CompareAndSwap(ctx, eventInfo, expected)
+		return err
+	})
+	return res, err
+}
+
+func (rer *retryingEventRepository) RestoreKey(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventSnapshot, error) {
+	var res *model.EventSnapshot
+	err := rer.retry(ctx, rer.timeouts.Write, func(ctx context.Context) (err error) {
+		res, err = rer.EventRepository.RestoreKey(ctx, eventQuery)
+		return err
+	})
+	return res, err
+}
+
+func (rer *retryingEventRepository) RevertKey(ctx context.Context, revertQuery *dto.RevertQuery) (*model.EventSnapshot, error) {
+	var res *model.EventSnapshot
+	err := rer.retry(ctx, rer.timeouts.Write, func(ctx context.Context) (err error) {
+		res, err = rer.EventRepository.RevertKey(ctx, revertQuery)
+		return err
+	})
+	return res, err
+}
+
+func (rer *retryingEventRepository) GetVersion(ctx context.Context, eventQuery *dto.EventQuery) (*model.EventHistory, error) {
+	var res *model.EventHistory
+	err := rer.retry(ctx, rer.timeouts.Read, func(ctx context.Context) (err error) {
+		res, err = rer.EventRepository.GetVersion(ctx, eventQuery)
+		return err
+	})
+	return res, err
+}
+
+func (rer *retryingEventRepository) ExpireKeys(ctx context.Context, now time.Time, limit int) ([]model.EventHistory, error) {
+	var history []model.EventHistory
+	err := rer.retry(ctx, rer.timeouts.Write, func(ctx context.Context) (err error) {
+		history, err = rer.EventRepository.ExpireKeys(ctx, now, limit)
+		return err
+	})
+	return history, err
+}
+
+// retry runs fn until it succeeds, fails with an error that is not retryable
+// or runs out of attempts. Every attempt shares the same timeout, on top of the
+// deadline of ctx, and retry gives up early when the next delay would pass it.
+func (rer *retryingEventRepository) retry(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil || !IsRetryable(err) || attempt >= rer.policy.MaxAttempts {
+			return err
+		}
+
+		delay := rer.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		if sleepErr := rer.sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// delay picks a random delay of up to the doubled base delay, "full jitter",
+// so that the writers that failed together do not retry together.
+func (rer *retryingEventRepository) delay(attempt int) time.Duration {
+	ceiling := rer.policy.BaseDelay << uint(attempt-1)
+	if ceiling <= 0 || ceiling > rer.policy.MaxDelay {
+		ceiling = rer.policy.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rer.jitter(int64(ceiling)) + 1)
+}
+
+// IsRetryable reports whether err is a transient database failure that an
+// operation can be retried after: a serialization failure, a deadlock, a lock
+// timeout or a lost connection. Failed commits are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrCommitFailed) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"55P03", // lock_not_available
+			"57P01", // admin_shutdown, e.g. during a failover
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+		// class 08 are the connection exceptions
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1205, // ER_LOCK_WAIT_TIMEOUT
+			1213, // ER_LOCK_DEADLOCK
+			1290: // ER_OPTION_PREVENTS_STATEMENT, a demoted primary in --read-only mode
+			return true
+		}
+		return false
+	}
+
+	if retryable, ok := isRetryableSQLite(err); ok {
+		return retryable
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// NewRetryingEventRepository retries the operations of repository that fail
+// with an error IsRetryable accepts according to policy, for as long as the
+// timeout of the operation allows.
+func NewRetryingEventRepository(repository EventRepository, policy RetryPolicy, timeouts QueryTimeouts) EventRepository {
+	return &retryingEventRepository{
+		EventRepository: repository,
+		policy:          policy,
+		timeouts:        timeouts,
+		sleep:           sleepContext,
+		jitter:          rand.Int63n,
+	}
+}
@@ -0,0 +1,20 @@
+//go:build cgo
+// +build cgo
+
+package repository
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// isRetryableSQLite classifies the errors of the sqlite driver, ok is false for
+// any other error. A busy or locked database is retryable.
+func isRetryableSQLite(err error) (retryable bool, ok bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false, false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked, true
+}
@@ -0,0 +1,10 @@
+//go:build !cgo
+// +build !cgo
+
+package repository
+
+// isRetryableSQLite never classifies an error without cgo, which the sqlite
+// driver needs to open a database at all.
+func isRetryableSQLite(error) (retryable bool, ok bool) {
+	return false, false
+}
@@ -0,0 +1,17 @@
+//go:build cgo
+// +build cgo
+
+package repository
+
+import (
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable_sqlite(t *testing.T) {
+	assert.True(t, IsRetryable(sqlite3.Error{Code: sqlite3.ErrBusy}))
+	assert.True(t, IsRetryable(sqlite3.Error{Code: sqlite3.ErrLocked}))
+	assert.False(t, IsRetryable(sqlite3.Error{Code: sqlite3.ErrConstraint}))
+}
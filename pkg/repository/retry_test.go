@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyEventRepository fails the first creates with the errors in fails.
+type flakyEventRepository struct {
+	EventRepository
+	fails     []error
+	attempts  int
+	deadlines []time.Time
+}
+
+func (fer *flakyEventRepository) CreateKey(ctx context.Context, eventInfo *model.EventSnapshot) error {
+	fer.attempts++
+	deadline, _ := ctx.Deadline()
+	fer.deadlines = append(fer.deadlines, deadline)
+	if fer.attempts <= len(fer.fails) {
+		return fer.fails[fer.attempts-1]
+	}
+	return fer.EventRepository.CreateKey(ctx, eventInfo)
+}
+
+func TestRetryingEventRepository(t *testing.T) {
+	serializationFailure := fmt.Errorf("failed to create key, error: %w", &pgconn.PgError{Code: "40001"})
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 15 * time.Millisecond}
+
+	newRepo := func(fails ...error) (*flakyEventRepository, *retryingEventRepository, *[]time.Duration) {
+		flaky := &flakyEventRepository{EventRepository: NewMemoryEventRepository(), fails: fails}
+		repo := NewRetryingEventRepository(flaky, policy, DefaultQueryTimeouts).(*retryingEventRepository)
+		delays := &[]time.Duration{}
+		repo.sleep = func(ctx context.Context, delay time.Duration) error {
+			*delays = append(*delays, delay)
+			return nil
+		}
+		repo.jitter = func(n int64) int64 { return n - 1 }
+		return flaky, repo, delays
+	}
+	snapshot := func() *model.EventSnapshot {
+		return &model.EventSnapshot{UserId: userId, Key: "name", Value: model.JSONValue(`"value"`)}
+	}
+
+	t.Run("retries transient errors with backoff", func(t *testing.T) {
+		flaky, repo, delays := newRepo(serializationFailure, driver.ErrBadConn)
+
+		require.NoError(t, repo.CreateKey(context.Background(), snapshot()))
+
+		assert.Equal(t, 3, flaky.attempts)
+		assert.Equal(t, []time.Duration{10 * time.Millisecond, 15 * time.Millisecond}, *delays)
+		assert.Equal(t, flaky.deadlines[0], flaky.deadlines[2], "attempts share the timeout of the operation")
+		history, _, err := repo.GetHistory(context.Background(), &dto.HistoryQuery{EventQuery: dto.EventQuery{Key: "name", UserId: userId}})
+		require.NoError(t, err)
+		assert.Len(t, history, 1)
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		flaky, repo, _ := newRepo(serializationFailure, serializationFailure, serializationFailure)
+
+		err := repo.CreateKey(context.Background(), snapshot())
+
+		assert.True(t, errors.Is(err, serializationFailure))
+		assert.Equal(t, 3, flaky.attempts)
+	})
+
+	t.Run("does not retry a failed commit", func(t *testing.T) {
+		flaky, repo, _ := newRepo(fmt.Errorf("%w, error: %v", ErrCommitFailed, driver.ErrBadConn))
+
+		err := repo.CreateKey(context.Background(), snapshot())
+
+		assert.True(t, errors.Is(err, ErrCommitFailed))
+		assert.Equal(t, 1, flaky.attempts)
+	})
+
+	t.Run("does not retry past the deadline", func(t *testing.T) {
+		flaky, repo, _ := newRepo(serializationFailure)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		err := repo.CreateKey(ctx, snapshot())
+
+		assert.True(t, errors.Is(err, serializationFailure))
+		assert.Equal(t, 1, flaky.attempts)
+	})
+
+	t.Run("does not retry past the timeout of the operation", func(t *testing.T) {
+		flaky, repo, _ := newRepo(serializationFailure)
+		repo.timeouts = QueryTimeouts{Write: time.Millisecond}
+
+		err := repo.CreateKey(context.Background(), snapshot())
+
+		assert.True(t, errors.Is(err, serializationFailure))
+		assert.Equal(t, 1, flaky.attempts)
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{&pgconn.PgError{Code: "40001"}, true},
+		{&pgconn.PgError{Code: "40P01"}, true},
+		{&pgconn.PgError{Code: "57P01"}, true},
+		{&pgconn.PgError{Code: "08006"}, true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{&mysql.MySQLError{Number: 1213}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{fmt.Errorf("failed to update key, error: %w", driver.ErrBadConn), true},
+		{fmt.Errorf("%w, error: %v", ErrCommitFailed, driver.ErrBadConn), false},
+		{context.DeadlineExceeded, false},
+		{ErrKeyNotFound, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.retryable, IsRetryable(tt.err), tt.err.Error())
+	}
+}
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultRebuildBatchSize = 1000
+
+// historyKeyOrder walks history key by key, each key in sequence order.
+var historyKeyOrder = clause.OrderBy{Columns: []clause.OrderByColumn{
+	{Column: clause.Column{Name: "user_id"}},
+	{Column: clause.Column{Name: "key"}},
+	{Column: clause.Column{Name: "sequence"}},
+}}
+
+// RebuildOptions scopes a snapshot rebuild. Empty UserId and KeyPrefix rebuild
+// the whole table. With DryRun the replay runs but its transaction is rolled back.
+type RebuildOptions struct {
+	UserId    string
+	KeyPrefix string
+	BatchSize int
+	DryRun    bool
+}
+
+type RebuildProgress struct {
+	HistoryRecords int
+	Snapshots      int
+}
+
+type RebuildResult struct {
+	RemovedSnapshots int64
+	HistoryRecords   int
+	Keys             int
+	Snapshots        int
+	DryRun           bool
+}
+
+type SnapshotRebuilder interface {
+	Rebuild(ctx context.Context, opts RebuildOptions, progress func(RebuildProgress)) (*RebuildResult, error)
+}
+
+type gormSnapshotRebuilder struct {
+	uow UnitOfWork
+}
+
+// Rebuild replays event_history into event_snapshot BatchSize keys at a time,
+// each batch in a transaction of its own that drops the snapshots in scope
+// between the last key of the previous batch and its own last key and writes
+// the replayed ones. Readers keep seeing the old snapshot of a key until its
+// batch commits, and a failed rebuild leaves the batches before it rebuilt.
+func (gsr *gormSnapshotRebuilder) Rebuild(ctx context.Context, opts RebuildOptions, progress func(RebuildProgress)) (*RebuildResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultRebuildBatchSize
+	}
+
+	result := &RebuildResult{DryRun: opts.DryRun}
+	scope := keyScope(opts.UserId, opts.KeyPrefix)
+	var after *historyKey
+	for {
+		var keys []historyKey
+		err := gsr.uow.Do(ctx, func(tx *gorm.DB) error {
+			var err error
+			if keys, err = historyKeys(tx, scope, after, opts.BatchSize); err != nil {
+				return err
+			}
+
+			batch := keyRange(scope, after, nil)
+			if len(keys) == opts.BatchSize {
+				batch = keyRange(scope, after, &keys[len(keys)-1])
+			}
+			if err := rebuildSnapshots(tx, batch, opts, result, progress); err != nil {
+				return err
+			}
+
+			if opts.DryRun {
+				return errRollback
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) < opts.BatchSize {
+			return result, nil
+		}
+		after = &keys[len(keys)-1]
+	}
+}
+
+// rebuildSnapshots replaces the snapshots in scope with the ones replayed from
+// the history in scope and adds the counts to result.
+func rebuildSnapshots(tx *gorm.DB, scope func(*gorm.DB) *gorm.DB, opts RebuildOptions, result *RebuildResult, progress func(RebuildProgress)) error {
+	deleted := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).
+		Scopes(scope).
+		Delete(&model.EventSnapshot{})
+	if deleted.Error != nil {
+		return fmt.Errorf("failed to clear snapshots, error: %w", deleted.Error)
+	}
+	result.RemovedSnapshots += deleted.RowsAffected
+
+	var pending []model.EventSnapshot
+	err := replayHistory(tx, scope, opts.BatchSize, func(state replayedKey) {
+		result.Keys++
+		if state.Live {
+			pending = append(pending, state.EventSnapshot)
+		}
+	}, func(records int) error {
+		result.HistoryRecords += records
+		if progress != nil {
+			progress(RebuildProgress{HistoryRecords: result.HistoryRecords, Snapshots: result.Snapshots})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := tx.CreateInBatches(pending, opts.BatchSize).Error; err != nil {
+		return fmt.Errorf("failed to write rebuilt snapshots, error: %w", err)
+	}
+	result.Snapshots += len(pending)
+	return nil
+}
+
+// replayedKey is the state a key ends up in once all of its history is applied.
+type replayedKey struct {
+	model.EventSnapshot
+	Live bool
+}
+
+// replayHistory streams the history in scope key by key and hands the final
+// state of every key to emit. batchDone is called after each batch read with
+// the number of records in it, emit has been called for every key completed so far.
+func replayHistory(tx *gorm.DB, scope func(*gorm.DB) *gorm.DB, batchSize int, emit func(replayedKey), batchDone func(records int) error) error {
+	var last *model.EventHistory
+	var current *replayedKey
+	for {
+		var batch []model.EventHistory
+		query := tx.Scopes(scope)
+		if last != nil {
+			query = query.Where(historyAfter(*last))
+		}
+
+		err := query.Clauses(historyKeyOrder).Limit(batchSize).Find(&batch).Error
+		if err != nil {
+			return fmt.Errorf("failed to read history, error: %w", err)
+		}
+
+		for i := range batch {
+			record := batch[i]
+			if current == nil || current.Key != record.Key || current.UserId != record.UserId {
+				if current != nil {
+					emit(*current)
+				}
+				current = &replayedKey{EventSnapshot: model.EventSnapshot{Key: record.Key, UserId: record.UserId}}
+			}
+
+			current.Live = !record.RemovesKey()
+			current.Value, current.ValueType, current.Version = record.Value, record.ValueType, record.Version
+			current.BlobHash, current.ExpiresAt = record.BlobHash, record.ExpiresAt
+		}
+
+		if len(batch) < batchSize {
+			if current != nil {
+				emit(*current)
+			}
+			return batchDone(len(batch))
+		}
+
+		if err := batchDone(len(batch)); err != nil {
+			return err
+		}
+		last = &batch[len(batch)-1]
+	}
+}
+
+// keyScope limits a query on event_snapshot or event_history to the keys of
+// a user starting with keyPrefix. Empty values do not restrict the query.
+func keyScope(userId, keyPrefix string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if userId != "" {
+			db = db.Where("user_id = ?", userId)
+		}
+
+		if keyPrefix != "" {
+			db = db.Where(keyPrefixCondition(keyPrefix))
+		}
+
+		return db
+	}
+}
+
+// historyAfter pages through history ordered by (user_id, key, sequence).
+func historyAfter(last model.EventHistory) clause.Expression {
+	return clause.Expr{
+		SQL: "((user_id > ?) or (user_id = ? and ? > ?) or (user_id = ? and ? = ? and sequence > ?))",
+		Vars: []interface{}{
+			last.UserId,
+			last.UserId, clause.Column{Name: "key"}, last.Key,
+			last.UserId, clause.Column{Name: "key"}, last.Key, last.Sequence,
+		},
+	}
+}
+
+// keyRange narrows scope to the keys after from up to and including to, a nil
+// bound leaves that side open.
+func keyRange(scope func(*gorm.DB) *gorm.DB, from, to *historyKey) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(scope)
+		if from != nil {
+			db = db.Where(keysAfter(*from))
+		}
+		if to != nil {
+			db = db.Where(clause.Expr{
+				SQL:  "((user_id < ?) or (user_id = ? and ? <= ?))",
+				Vars: []interface{}{to.UserId, to.UserId, clause.Column{Name: "key"}, to.Key},
+			})
+		}
+		return db
+	}
+}
+
+// keysAfter pages through keys ordered by (user_id, key).
+func keysAfter(last historyKey) clause.Expression {
+	return clause.Expr{
+		SQL:  "((user_id > ?) or (user_id = ? and ? > ?))",
+		Vars: []interface{}{last.UserId, last.UserId, clause.Column{Name: "key"}, last.Key},
+	}
+}
+
+// keyPrefixCondition matches keys starting with prefix. Wildcards in the prefix
+// are escaped and the escape character is spelled out as sqlite has no default.
+func keyPrefixCondition(prefix string) clause.Expression {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+
+	return clause.Expr{
+		SQL:  "? like ? escape ?",
+		Vars: []interface{}{clause.Column{Name: "key"}, escaped + "%", `\`},
+	}
+}
+
+func NewSnapshotRebuilder(db *gorm.DB) SnapshotRebuilder {
+	return &gormSnapshotRebuilder{
+		uow: NewUnitOfWork(db),
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGormSnapshotRebuilder_Rebuild(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.UpdateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"sam"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "city", Value: `"pune"`, UserId: userId}))
+	require.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "city", UserId: userId}))
+	dbConn.WithContext(ctx).Where("user_id = ?", userId).Delete(&model.EventSnapshot{})
+	dbConn.WithContext(ctx).Create(&model.EventSnapshot{Key: "orphan", Value: `"x"`, UserId: userId, Version: 1})
+	var progressCalls int
+
+	result, err := NewSnapshotRebuilder(dbConn).Rebuild(ctx, RebuildOptions{UserId: userId, BatchSize: 1}, func(RebuildProgress) {
+		progressCalls++
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, &RebuildResult{RemovedSnapshots: 1, HistoryRecords: 4, Keys: 2, Snapshots: 1}, result)
+	assert.True(t, progressCalls >= 4)
+	var snapshots []model.EventSnapshot
+	dbConn.WithContext(ctx).Where("user_id = ?", userId).Find(&snapshots)
+	assert.Equal(t, []model.EventSnapshot{{Key: "name", Value: `"sam"`, ValueType: model.StringValue, UserId: userId, Version: 2}}, snapshots)
+}
+
+func TestGormSnapshotRebuilder_Rebuild_dryRunWithKeyPrefix(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "pref_a", Value: `"1"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "prefXb", Value: `"2"`, UserId: userId}))
+	dbConn.WithContext(ctx).Where("user_id = ?", userId).Delete(&model.EventSnapshot{})
+
+	result, err := NewSnapshotRebuilder(dbConn).Rebuild(ctx, RebuildOptions{UserId: userId, KeyPrefix: "pref_", DryRun: true}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, &RebuildResult{HistoryRecords: 1, Keys: 1, Snapshots: 1, DryRun: true}, result)
+	var count int64
+	dbConn.WithContext(ctx).Model(&model.EventSnapshot{}).Where("user_id = ?", userId).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestGormSnapshotRebuilder_Rebuild_commitsPerBatch(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "a", Value: `"1"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "b", Value: `"2"`, UserId: userId}))
+	dbConn.WithContext(ctx).Model(&model.EventSnapshot{}).Where("user_id = ?", userId).Update("value", `"drifted"`)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	_, err := NewSnapshotRebuilder(dbConn).Rebuild(ctx, RebuildOptions{UserId: userId, BatchSize: 1}, func(progress RebuildProgress) {
+		if progress.HistoryRecords > 1 {
+			cancel()
+		}
+	})
+
+	require.Error(t, err)
+	var snapshots []model.EventSnapshot
+	dbConn.Where("user_id = ?", userId).Order("key").Find(&snapshots)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, model.JSONValue(`"1"`), snapshots[0].Value, "the first batch was committed")
+	assert.Equal(t, model.JSONValue(`"drifted"`), snapshots[1].Value)
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"event-history/pkg/eventinfo/model"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds of drift between event_snapshot and event_history. When a snapshot
+// differs in both value and version it is reported as a value mismatch, so is
+// a snapshot that refers to another blob than its history.
+const (
+	DriftMissingSnapshot = "missing_snapshot"
+	DriftStaleSnapshot   = "stale_snapshot"
+	DriftOrphanSnapshot  = "orphan_snapshot"
+	DriftValueMismatch   = "value_mismatch"
+	DriftVersionMismatch = "version_mismatch"
+)
+
+// VerifyOptions scopes a consistency check the same way RebuildOptions scopes a
+// rebuild. With Repair the drift found is fixed in the transaction that found it.
+type VerifyOptions struct {
+	UserId    string
+	KeyPrefix string
+	BatchSize int
+	Repair    bool
+}
+
+// Drift is a key whose snapshot disagrees with its history. Snapshot is the row
+// found in event_snapshot, History the state replayed from event_history.
+type Drift struct {
+	Kind     string               `json:"kind"`
+	UserId   string               `json:"user_id"`
+	Key      string               `json:"key"`
+	Snapshot *model.EventSnapshot `json:"snapshot,omitempty"`
+	History  *model.EventSnapshot `json:"history,omitempty"`
+}
+
+type VerifyReport struct {
+	HistoryRecords int     `json:"history_records"`
+	Keys           int     `json:"keys"`
+	Drifts         []Drift `json:"drifts"`
+	Repaired       bool    `json:"repaired"`
+}
+
+type SnapshotVerifier interface {
+	Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error)
+}
+
+type gormSnapshotVerifier struct {
+	uow UnitOfWork
+}
+
+// Verify replays event_history and compares the outcome with event_snapshot.
+// Snapshots without any history are orphans, history is the source of truth
+// so repairing drops them just like rebuild-snapshot would.
+func (gsv *gormSnapshotVerifier) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultRebuildBatchSize
+	}
+
+	var report *VerifyReport
+	err := gsv.uow.Do(ctx, func(tx *gorm.DB) error {
+		var err error
+		if report, err = verifySnapshots(tx, opts); err != nil {
+			return err
+		}
+
+		if !opts.Repair || len(report.Drifts) == 0 {
+			return errRollback
+		}
+		return repairDrifts(tx, report.Drifts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Repaired = opts.Repair && len(report.Drifts) > 0
+	return report, nil
+}
+
+func verifySnapshots(tx *gorm.DB, opts VerifyOptions) (*VerifyReport, error) {
+	report := &VerifyReport{Drifts: []Drift{}}
+
+	var pending []replayedKey
+	check := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+
+		snapshots, err := snapshotsOf(tx, pending)
+		if err != nil {
+			return err
+		}
+
+		for _, state := range pending {
+			snapshot := snapshots[snapshotKey{key: state.Key, userId: state.UserId}]
+			if drift := compareSnapshot(state, snapshot); drift != nil {
+				report.Drifts = append(report.Drifts, *drift)
+			}
+		}
+
+		pending = pending[:0]
+		return nil
+	}
+
+	scope := keyScope(opts.UserId, opts.KeyPrefix)
+	err := replayHistory(tx, scope, opts.BatchSize, func(state replayedKey) {
+		report.Keys++
+		pending = append(pending, state)
+	}, func(records int) error {
+		report.HistoryRecords += records
+		if len(pending) >= opts.BatchSize {
+			return check()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := check(); err != nil {
+		return nil, err
+	}
+
+	var orphans []model.EventSnapshot
+	err = tx.Scopes(scope).Where("not exists (?)", historyOfSnapshot(tx)).Find(&orphans).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots without history, error: %w", err)
+	}
+
+	for i := range orphans {
+		orphan := orphans[i]
+		report.Drifts = append(report.Drifts, Drift{Kind: DriftOrphanSnapshot, UserId: orphan.UserId, Key: orphan.Key, Snapshot: &orphan})
+	}
+
+	return report, nil
+}
+
+// snapshotsOf loads the snapshots of the replayed keys. Users and keys are
+// matched separately, which may load a few extra rows that are simply not looked up.
+func snapshotsOf(tx *gorm.DB, states []replayedKey) (map[snapshotKey]*model.EventSnapshot, error) {
+	var users, keys []interface{}
+	seenUsers, seenKeys := map[string]bool{}, map[string]bool{}
+	for _, state := range states {
+		if !seenUsers[state.UserId] {
+			seenUsers[state.UserId] = true
+			users = append(users, state.UserId)
+		}
+		if !seenKeys[state.Key] {
+			seenKeys[state.Key] = true
+			keys = append(keys, state.Key)
+		}
+	}
+
+	var snapshots []model.EventSnapshot
+	err := tx.Where(clause.IN{Column: clause.Column{Name: "user_id"}, Values: users}).
+		Where(clause.IN{Column: clause.Column{Name: "key"}, Values: keys}).
+		Find(&snapshots).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots, error: %w", err)
+	}
+
+	res := make(map[snapshotKey]*model.EventSnapshot, len(snapshots))
+	for i := range snapshots {
+		res[snapshotKey{key: snapshots[i].Key, userId: snapshots[i].UserId}] = &snapshots[i]
+	}
+	return res, nil
+}
+
+func compareSnapshot(state replayedKey, snapshot *model.EventSnapshot) *Drift {
+	drift := &Drift{UserId: state.UserId, Key: state.Key, Snapshot: snapshot}
+	if state.Live {
+		history := state.EventSnapshot
+		drift.History = &history
+	}
+
+	switch {
+	case snapshot == nil && !state.Live:
+		return nil
+	case snapshot == nil:
+		drift.Kind = DriftMissingSnapshot
+	case !state.Live:
+		drift.Kind = DriftStaleSnapshot
+	case snapshot.BlobHash != state.BlobHash || !snapshot.Value.Equal(state.Value):
+		drift.Kind = DriftValueMismatch
+	case snapshot.Version != state.Version:
+		drift.Kind = DriftVersionMismatch
+	default:
+		return nil
+	}
+
+	return drift
+}
+
+// historyOfSnapshot selects the history of the event_snapshot row of the outer query.
+func historyOfSnapshot(tx *gorm.DB) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true}).
+		Model(&model.EventHistory{}).
+		Select("1").
+		Where(clause.Expr{
+			SQL: "? = ? and ? = ?",
+			Vars: []interface{}{
+				clause.Column{Table: model.EventHistory{}.TableName(), Name: "user_id"},
+				clause.Column{Table: model.EventSnapshot{}.TableName(), Name: "user_id"},
+				clause.Column{Table: model.EventHistory{}.TableName(), Name: "key"},
+				clause.Column{Table: model.EventSnapshot{}.TableName(), Name: "key"},
+			},
+		})
+}
+
+// repairDrifts makes event_snapshot agree with the replayed history.
+func repairDrifts(tx *gorm.DB, drifts []Drift) error {
+	for _, drift := range drifts {
+		var err error
+		switch drift.Kind {
+		case DriftMissingSnapshot:
+			err = tx.Create(drift.History).Error
+		case DriftStaleSnapshot, DriftOrphanSnapshot:
+			err = tx.Where(keyCondition(drift.Key, drift.UserId)).Delete(&model.EventSnapshot{}).Error
+		case DriftValueMismatch, DriftVersionMismatch:
+			err = tx.Model(&model.EventSnapshot{}).
+				Where(keyCondition(drift.Key, drift.UserId)).
+				Updates(snapshotValueColumns(drift.History)).Error
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to repair %s of %s/%s, error: %w", drift.Kind, drift.UserId, drift.Key, err)
+		}
+	}
+
+	return nil
+}
+
+func NewSnapshotVerifier(db *gorm.DB) SnapshotVerifier {
+	return &gormSnapshotVerifier{
+		uow: NewUnitOfWork(db),
+	}
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"event-history/pkg/eventinfo/dto"
+	"event-history/pkg/eventinfo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGormSnapshotVerifier_Verify(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "city", Value: `"pune"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "age", Value: `"30"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "zip", Value: `"411001"`, UserId: userId}))
+	require.NoError(t, repository.DeleteKey(ctx, &dto.EventQuery{Key: "zip", UserId: userId}))
+	dbConn.WithContext(ctx).Model(&model.EventSnapshot{}).Where(keyCondition("name", userId)).Update("value", `"sam"`)
+	dbConn.WithContext(ctx).Model(&model.EventSnapshot{}).Where(keyCondition("age", userId)).Update("version", 7)
+	dbConn.WithContext(ctx).Where(keyCondition("city", userId)).Delete(&model.EventSnapshot{})
+	dbConn.WithContext(ctx).Create(&model.EventSnapshot{Key: "zip", Value: `"411001"`, UserId: userId, Version: 1})
+	dbConn.WithContext(ctx).Create(&model.EventSnapshot{Key: "orphan", Value: `"x"`, UserId: userId, Version: 1})
+
+	report, err := NewSnapshotVerifier(dbConn).Verify(ctx, VerifyOptions{UserId: userId, BatchSize: 2})
+
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.HistoryRecords)
+	assert.Equal(t, 4, report.Keys)
+	assert.False(t, report.Repaired)
+	assert.ElementsMatch(t, []string{
+		DriftVersionMismatch + "/age",
+		DriftMissingSnapshot + "/city",
+		DriftValueMismatch + "/name",
+		DriftStaleSnapshot + "/zip",
+		DriftOrphanSnapshot + "/orphan",
+	}, driftsOf(report))
+	var count int64
+	dbConn.WithContext(ctx).Model(&model.EventSnapshot{}).Where("user_id = ?", userId).Count(&count)
+	assert.Equal(t, int64(4), count)
+}
+
+func TestGormSnapshotVerifier_Verify_repair(t *testing.T) {
+	dbConn, ctx := setUp()
+	repository := NewEventRepository(dbConn)
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId}))
+	require.NoError(t, repository.CreateKey(ctx, &model.EventSnapshot{Key: "city", Value: `"pune"`, UserId: userId}))
+	dbConn.WithContext(ctx).Model(&model.EventSnapshot{}).Where(keyCondition("name", userId)).Update("value", `"sam"`)
+	dbConn.WithContext(ctx).Where(keyCondition("city", userId)).Delete(&model.EventSnapshot{})
+	dbConn.WithContext(ctx).Create(&model.EventSnapshot{Key: "orphan", Value: `"x"`, UserId: userId, Version: 1})
+	verifier := NewSnapshotVerifier(dbConn)
+
+	report, err := verifier.Verify(ctx, VerifyOptions{UserId: userId, Repair: true})
+
+	require.NoError(t, err)
+	assert.True(t, report.Repaired)
+	assert.Len(t, report.Drifts, 3)
+	var snapshots []model.EventSnapshot
+	dbConn.WithContext(ctx).Where("user_id = ?", userId).Order("key").Find(&snapshots)
+	assert.Equal(t, []model.EventSnapshot{
+		{Key: "city", Value: `"pune"`, ValueType: model.StringValue, UserId: userId, Version: 1},
+		{Key: "name", Value: `"john"`, ValueType: model.StringValue, UserId: userId, Version: 1},
+	}, snapshots)
+
+	report, err = verifier.Verify(ctx, VerifyOptions{UserId: userId})
+
+	require.NoError(t, err)
+	assert.Empty(t, report.Drifts)
+}
+
+func driftsOf(report *VerifyReport) []string {
+	res := make([]string, 0, len(report.Drifts))
+	for _, drift := range report.Drifts {
+		res = append(res, drift.Kind+"/"+drift.Key)
+	}
+	return res
+}
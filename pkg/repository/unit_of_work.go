@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrCommitFailed is returned when the statements of a unit of work succeeded
+// but the transaction could not be committed, its outcome is then unknown to the caller.
+var ErrCommitFailed = errors.New("commit failed")
+
+// errRollback can be returned by the fn of a unit of work to roll it back
+// without failing, e.g. for dry runs.
+var errRollback = errors.New("rollback requested")
+
+// UnitOfWork runs a group of statements in one transaction. Every statement of fn
+// has to go through the tx it is handed, they commit together when fn returns nil
+// and are rolled back when it returns an error or panics.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(tx *gorm.DB) error) error
+}
+
+type gormUnitOfWork struct {
+	db *gorm.DB
+}
+
+// Do begins the transaction with ctx, so its deadline applies to the whole
+// transaction and not just to the statements run in it.
+func (guw *gormUnitOfWork) Do(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	tx := guw.db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction, error: %w", tx.Error)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); errors.Is(err, errRollback) {
+		tx.Rollback()
+		return nil
+	} else if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("%w, error: %v", ErrCommitFailed, err)
+	}
+
+	return nil
+}
+
+func NewUnitOfWork(db *gorm.DB) UnitOfWork {
+	return &gormUnitOfWork{
+		db: db,
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+	"event-history/pkg/eventinfo/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestGormUnitOfWork_Do(t *testing.T) {
+	dbConn, ctx := setUp()
+
+	err := NewUnitOfWork(dbConn).Do(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId, Version: 1}).Error; err != nil {
+			return err
+		}
+		return historize(tx, &model.EventHistory{Key: "name", Value: `"john"`, UserId: userId, Action: model.CreateAction, Version: 1})
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), countRows(dbConn, &model.EventSnapshot{}))
+	assert.Equal(t, int64(1), countRows(dbConn, &model.EventHistory{}))
+}
+
+func TestGormUnitOfWork_Do_rollsBackOnError(t *testing.T) {
+	dbConn, ctx := setUp()
+	failure := errors.New("history write failed")
+
+	err := NewUnitOfWork(dbConn).Do(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId, Version: 1}).Error; err != nil {
+			return err
+		}
+		return failure
+	})
+
+	assert.True(t, errors.Is(err, failure))
+	assert.Equal(t, int64(0), countRows(dbConn, &model.EventSnapshot{}))
+}
+
+func TestGormUnitOfWork_Do_rollsBackOnRequest(t *testing.T) {
+	dbConn, ctx := setUp()
+
+	err := NewUnitOfWork(dbConn).Do(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId, Version: 1}).Error; err != nil {
+			return err
+		}
+		return errRollback
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), countRows(dbConn, &model.EventSnapshot{}))
+}
+
+func TestGormUnitOfWork_Do_rollsBackOnPanic(t *testing.T) {
+	dbConn, ctx := setUp()
+
+	assert.Panics(t, func() {
+		_ = NewUnitOfWork(dbConn).Do(ctx, func(tx *gorm.DB) error {
+			tx.Create(&model.EventSnapshot{Key: "name", Value: `"john"`, UserId: userId, Version: 1})
+			panic("boom")
+		})
+	})
+
+	assert.Equal(t, int64(0), countRows(dbConn, &model.EventSnapshot{}))
+}
+
+func countRows(dbConn *gorm.DB, table interface{}) int64 {
+	var count int64
+	dbConn.Model(table).Where("user_id = ?", userId).Count(&count)
+	return count
+}